@@ -0,0 +1,33 @@
+// Package clido is a Go client for the cli-do API.
+//
+//	client := clido.NewClient(config, clido.WithAuth(auth))
+//	projects, err := client.GetProjects(ctx)
+//
+// Errors returned by the server are *ApiError values that match the ErrNotFound,
+// ErrUnauthorized and related sentinels with errors.Is.
+package clido
+
+import "context"
+
+// Api is the surface of the cli-do API implemented by Client. Depend on it
+// rather than on *Client to substitute a mock in tests.
+type Api interface {
+	Login(ctx context.Context, login Login) error
+	RefreshToken(ctx context.Context) error
+	RevokeToken(ctx context.Context) error
+	RequestDeviceCode(ctx context.Context) (DeviceAuthorization, error)
+	PollDeviceToken(ctx context.Context, authorization DeviceAuthorization) error
+	GetProjects(ctx context.Context) (Projects, error)
+	GetProject(ctx context.Context, projectId string) (Project, error)
+	CreateProject(ctx context.Context, createProject CreateProject) (Project, error)
+	ArchiveProject(ctx context.Context, projectId string) error
+	ListTodos(ctx context.Context, projectId string, all bool) (Todos, error)
+	QueryTodos(ctx context.Context, projectId string, query TodoQuery) (Todos, error)
+	GetTodo(ctx context.Context, projectId string, ticket string) (Todo, error)
+	CreateTodo(ctx context.Context, projectId string, createTodo CreateTodo) (Todo, error)
+	UpdateTodo(ctx context.Context, projectId string, ticket string, updateTodo UpdateTodo) error
+	ArchiveTodo(ctx context.Context, projectId string, ticket string) error
+	CompleteTodo(ctx context.Context, projectId string, ticket string) error
+}
+
+var _ Api = (*Client)(nil)
@@ -0,0 +1,19 @@
+package clido
+
+import "time"
+
+// Tokens are treated as expired slightly early so a request does not race the
+// server-side expiry.
+const tokenExpiryLeeway = 30 * time.Second
+
+func (auth Auth) ExpiresAt() time.Time {
+	return time.Unix(int64(auth.CreatedAt), 0).Add(time.Duration(auth.ExpiresIn) * time.Second)
+}
+
+func (auth Auth) IsExpired() bool {
+	if auth.CreatedAt == 0 || auth.ExpiresIn == 0 {
+		return false
+	}
+
+	return time.Now().Add(tokenExpiryLeeway).After(auth.ExpiresAt())
+}
@@ -0,0 +1,480 @@
+package clido
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Client talks to the cli-do API. It is safe for concurrent use; requests
+// that find the token expired at the same time share a single refresh.
+type Client struct {
+	mu        sync.Mutex
+	refreshMu sync.Mutex
+	auth      Auth
+	config    Config
+	client    *resty.Client
+	onRefresh func(Auth) error
+
+	// pollIntervalUnit scales device flow poll intervals so tests need not
+	// wait whole seconds.
+	pollIntervalUnit time.Duration
+}
+
+type Option func(*Client)
+
+// WithAuth sets the credentials used for authenticated requests.
+func WithAuth(auth Auth) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// WithHttpClient replaces the resty client built from Config, for callers
+// that need their own transport or middleware.
+func WithHttpClient(client *resty.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithTokenRefreshed is called with the new credentials after every
+// successful token refresh so they can be persisted.
+func WithTokenRefreshed(onRefresh func(Auth) error) Option {
+	return func(c *Client) {
+		c.onRefresh = onRefresh
+	}
+}
+
+func NewClient(config Config, opts ...Option) *Client {
+	var c = &Client{
+		config: config,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.client == nil {
+		c.client = NewHttpClient(config)
+	}
+
+	return c
+}
+
+// Auth returns the credentials currently in use, including any obtained by
+// Login or a token refresh.
+func (api *Client) Auth() Auth {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	return api.auth
+}
+
+func (api *Client) setAuth(auth Auth) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.auth = auth
+}
+
+func (api *Client) Login(ctx context.Context, login Login) error {
+	var endpoint = fmt.Sprintf("%s/login", api.config.Endpoint)
+	resp, err := api.postNoAuth(ctx, endpoint, login, "User")
+
+	if err != nil {
+		var apiError *ApiError
+		if errors.As(err, &apiError) && apiError.StatusCode == 401 {
+			apiError.Message = "Invalid email or password."
+		}
+
+		return err
+	}
+
+	var auth Auth
+	err = json.Unmarshal(resp.Body(), &auth)
+
+	if err != nil {
+		return err
+	}
+
+	api.setAuth(auth)
+
+	return nil
+}
+
+func (api *Client) GetProjects(ctx context.Context) (Projects, error) {
+	var endpoint = fmt.Sprintf("%s/projects", api.config.Endpoint)
+	resp, err := api.get(ctx, endpoint, "Projects")
+
+	if err != nil {
+		return Projects{}, err
+	}
+
+	var projects Projects
+	err = json.Unmarshal(resp.Body(), &projects)
+
+	if err != nil {
+		return Projects{}, err
+	}
+
+	return projects, nil
+}
+
+func (api *Client) GetProject(ctx context.Context, projectId string) (Project, error) {
+	var endpoint = fmt.Sprintf("%s/projects/%s", api.config.Endpoint, projectId)
+
+	resp, err := api.get(ctx, endpoint, "Project")
+
+	if err != nil {
+		return Project{}, err
+	}
+
+	var project Project
+	err = json.Unmarshal(resp.Body(), &project)
+
+	if err != nil {
+		return Project{}, err
+	}
+
+	return project, nil
+}
+
+func (api *Client) CreateProject(ctx context.Context, createProject CreateProject) (Project, error) {
+	var endpoint = fmt.Sprintf("%s/projects", api.config.Endpoint)
+	resp, err := api.post(ctx, endpoint, createProject, "Project")
+
+	if err != nil {
+		return Project{}, err
+	}
+
+	var createdProject Project
+	err = json.Unmarshal(resp.Body(), &createdProject)
+
+	if err != nil {
+		return Project{}, err
+	}
+
+	return createdProject, nil
+}
+
+func (api *Client) ArchiveProject(ctx context.Context, projectId string) error {
+	var endpoint = fmt.Sprintf("%s/projects/%s", api.config.Endpoint, projectId)
+	_, err := api.delete(ctx, endpoint, "Project")
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (api *Client) ListTodos(ctx context.Context, projectId string, all bool) (Todos, error) {
+	return api.QueryTodos(ctx, projectId, TodoQuery{All: all})
+}
+
+// QueryTodos lists the todos of a project, asking the server to apply
+// query. Filters the server does not support are not applied.
+func (api *Client) QueryTodos(ctx context.Context, projectId string, query TodoQuery) (Todos, error) {
+	var endpoint = fmt.Sprintf("%s/projects/%s/todos?%s", api.config.Endpoint, projectId, query.Values().Encode())
+	resp, err := api.get(ctx, endpoint, "Todos")
+
+	if err != nil {
+		return Todos{}, err
+	}
+
+	var todos Todos
+	err = json.Unmarshal(resp.Body(), &todos)
+
+	if err != nil {
+		return Todos{}, err
+	}
+
+	return todos, nil
+}
+
+func (api *Client) GetTodo(ctx context.Context, projectId string, ticket string) (Todo, error) {
+	var endpoint = fmt.Sprintf("%s/projects/%s/todos/%s", api.config.Endpoint, projectId, ticket)
+	resp, err := api.get(ctx, endpoint, "Todo")
+
+	if err != nil {
+		return Todo{}, err
+	}
+
+	var todo Todo
+	err = json.Unmarshal(resp.Body(), &todo)
+
+	if err != nil {
+		return Todo{}, err
+	}
+
+	todo.ETag = resp.Header().Get("ETag")
+
+	return todo, nil
+}
+
+func (api *Client) CreateTodo(ctx context.Context, projectId string, createTodo CreateTodo) (Todo, error) {
+	var endpoint = fmt.Sprintf("%s/projects/%s/todos", api.config.Endpoint, projectId)
+	resp, err := api.post(ctx, endpoint, createTodo, "Todo")
+
+	if err != nil {
+		return Todo{}, err
+	}
+
+	var createdTodo Todo
+	err = json.Unmarshal(resp.Body(), &createdTodo)
+
+	if err != nil {
+		return Todo{}, err
+	}
+
+	return createdTodo, nil
+}
+
+// UpdateTodo replaces a todo. When updateTodo carries the ETag of the copy it
+// was based on, the server refuses the update with ErrConflict if the todo
+// has changed since.
+func (api *Client) UpdateTodo(ctx context.Context, projectId string, ticket string, updateTodo UpdateTodo) error {
+	var endpoint = fmt.Sprintf("%s/projects/%s/todos/%s", api.config.Endpoint, projectId, ticket)
+	var ifMatch = func(request *resty.Request) {
+		if updateTodo.Todo.ETag != "" {
+			request.SetHeader("If-Match", updateTodo.Todo.ETag)
+		}
+	}
+
+	_, err := api.put(ctx, endpoint, updateTodo, "Todo", ifMatch)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (api *Client) ArchiveTodo(ctx context.Context, projectId string, ticket string) error {
+	var endpoint = fmt.Sprintf("%s/projects/%s/todos/%s", api.config.Endpoint, projectId, ticket)
+	_, err := api.delete(ctx, endpoint, "Todo")
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (api *Client) CompleteTodo(ctx context.Context, projectId string, ticket string) error {
+	var endpoint = fmt.Sprintf("%s/projects/%s/todos/%s/complete", api.config.Endpoint, projectId, ticket)
+	_, err := api.post(ctx, endpoint, nil, "Todo")
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (api *Client) RefreshToken(ctx context.Context) error {
+	api.refreshMu.Lock()
+	defer api.refreshMu.Unlock()
+
+	return api.refresh(ctx)
+}
+
+// refreshIfStale refreshes unless another request already replaced
+// accessToken while this one waited for the refresh lock.
+func (api *Client) refreshIfStale(ctx context.Context, accessToken string) error {
+	api.refreshMu.Lock()
+	defer api.refreshMu.Unlock()
+
+	if api.Auth().AccessToken != accessToken {
+		return nil
+	}
+
+	return api.refresh(ctx)
+}
+
+// refresh exchanges the refresh token for new credentials. Callers hold
+// refreshMu.
+func (api *Client) refresh(ctx context.Context) error {
+	var current = api.Auth()
+
+	if current.RefreshToken == "" {
+		return &ApiError{
+			StatusCode: 401,
+			Message:    "Session expired. Please run 'cli-do login --force'.",
+		}
+	}
+
+	var endpoint = fmt.Sprintf("%s/refresh", api.config.Endpoint)
+	resp, err := api.postNoAuth(ctx, endpoint, Refresh{
+		RefreshToken: current.RefreshToken,
+		ClientId:     api.config.ClientId,
+		GrantType:    "refresh_token",
+	}, "Session")
+
+	if err != nil {
+		var apiError *ApiError
+		if errors.As(err, &apiError) && apiError.StatusCode == 401 {
+			apiError.Message = "Session expired. Please run 'cli-do login --force'."
+		}
+
+		return err
+	}
+
+	var auth Auth
+	err = json.Unmarshal(resp.Body(), &auth)
+
+	if err != nil {
+		return err
+	}
+
+	if auth.Email == "" {
+		auth.Email = current.Email
+	}
+
+	if auth.RefreshToken == "" {
+		auth.RefreshToken = current.RefreshToken
+	}
+
+	if auth.CreatedAt == 0 {
+		auth.CreatedAt = int(time.Now().Unix())
+	}
+
+	api.setAuth(auth)
+
+	if api.onRefresh != nil {
+		return api.onRefresh(auth)
+	}
+
+	return nil
+}
+
+// RevokeToken asks the server to invalidate the current access and refresh
+// tokens. Tokens the server no longer recognises are not an error.
+func (api *Client) RevokeToken(ctx context.Context) error {
+	var endpoint = fmt.Sprintf("%s/revoke", api.config.Endpoint)
+	var current = api.Auth()
+	var tokens = []Revoke{
+		{Token: current.AccessToken, TokenTypeHint: "access_token"},
+		{Token: current.RefreshToken, TokenTypeHint: "refresh_token"},
+	}
+
+	for _, revoke := range tokens {
+		if revoke.Token == "" {
+			continue
+		}
+
+		revoke.ClientId = api.config.ClientId
+		_, err := api.postNoAuth(ctx, endpoint, revoke, "Session")
+
+		if err != nil && !errors.Is(err, ErrUnauthorized) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (api *Client) withRefresh(ctx context.Context, request func(accessToken string) (*resty.Response, error)) (*resty.Response, error) {
+	var refreshed = false
+	var current = api.Auth()
+
+	if current.IsExpired() && current.RefreshToken != "" {
+		if err := api.refreshIfStale(ctx, current.AccessToken); err != nil {
+			return nil, err
+		}
+
+		refreshed = true
+		current = api.Auth()
+	}
+
+	resp, err := request(current.AccessToken)
+
+	if refreshed || !errors.Is(err, ErrUnauthorized) {
+		return resp, err
+	}
+
+	if err := api.refreshIfStale(ctx, current.AccessToken); err != nil {
+		return resp, err
+	}
+
+	return request(api.Auth().AccessToken)
+}
+
+func (api *Client) get(ctx context.Context, endpoint string, entity string) (*resty.Response, error) {
+	return api.withRefresh(ctx, func(accessToken string) (*resty.Response, error) {
+		return api.execute(ctx, resty.MethodGet, endpoint, nil, entity, accessToken)
+	})
+}
+
+func (api *Client) post(ctx context.Context, endpoint string, body interface{}, entity string) (*resty.Response, error) {
+	return api.withRefresh(ctx, func(accessToken string) (*resty.Response, error) {
+		return api.execute(ctx, resty.MethodPost, endpoint, body, entity, accessToken)
+	})
+}
+
+func (api *Client) put(ctx context.Context, endpoint string, body interface{}, entity string, options ...func(*resty.Request)) (*resty.Response, error) {
+	return api.withRefresh(ctx, func(accessToken string) (*resty.Response, error) {
+		return api.execute(ctx, resty.MethodPut, endpoint, body, entity, accessToken, options...)
+	})
+}
+
+func (api *Client) delete(ctx context.Context, endpoint string, entity string) (*resty.Response, error) {
+	return api.withRefresh(ctx, func(accessToken string) (*resty.Response, error) {
+		return api.execute(ctx, resty.MethodDelete, endpoint, nil, entity, accessToken)
+	})
+}
+
+func (api *Client) postNoAuth(ctx context.Context, endpoint string, body interface{}, entity string) (*resty.Response, error) {
+	return api.execute(ctx, resty.MethodPost, endpoint, body, entity, "")
+}
+
+// execute sends one request, authenticated with accessToken unless it is
+// empty. Options can set extra headers.
+func (api *Client) execute(ctx context.Context, method string, endpoint string, body interface{}, entity string, accessToken string, options ...func(*resty.Request)) (*resty.Response, error) {
+	var sent atomic.Bool
+	var trace = &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				sent.Store(true)
+			}
+		},
+	}
+
+	var request = api.client.R().SetContext(httptrace.WithClientTrace(ctx, trace))
+
+	if accessToken != "" {
+		request.SetAuthToken(accessToken)
+	}
+
+	if body != nil {
+		request.SetHeader("Content-Type", "application/json").SetBody(body)
+	}
+
+	for _, option := range options {
+		option(request)
+	}
+
+	resp, err := request.Execute(method, endpoint)
+
+	if err != nil {
+		if ctx.Err() != nil && method != resty.MethodGet {
+			return resp, &CancelledError{
+				Entity: entity,
+				Sent:   sent.Load(),
+				Err:    ctx.Err(),
+			}
+		}
+
+		return resp, err
+	}
+
+	return resp, HandleResponseNotOk(resp, entity)
+}
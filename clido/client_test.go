@@ -0,0 +1,226 @@
+package clido_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func newTestClient(t *testing.T, opts ...clido.Option) (*clido.Client, *clidotest.Server) {
+	t.Helper()
+
+	var server = clidotest.NewServer()
+	t.Cleanup(server.Close)
+
+	var config = clido.DefaultConfig()
+	config.Endpoint = server.URL
+
+	return clido.NewClient(config, opts...), server
+}
+
+func TestLogin(t *testing.T) {
+	client, server := newTestClient(t)
+	server.AddUser("reed@example.com", "hunter2")
+
+	err := client.Login(context.Background(), clido.Login{Email: "reed@example.com", Password: "wrong"})
+
+	if !errors.Is(err, clido.ErrUnauthorized) {
+		t.Fatalf("wrong password: got %v, want ErrUnauthorized", err)
+	}
+
+	if err := client.Login(context.Background(), clido.Login{Email: "reed@example.com", Password: "hunter2"}); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	if client.Auth().AccessToken == "" || client.Auth().Email != "reed@example.com" {
+		t.Fatalf("unexpected auth %+v", client.Auth())
+	}
+
+	if _, err := client.GetProjects(context.Background()); err != nil {
+		t.Fatalf("get projects after login: %v", err)
+	}
+}
+
+func TestConcurrentRequestsShareRefresh(t *testing.T) {
+	var refreshes atomic.Int32
+
+	client, server := newTestClient(t, clido.WithTokenRefreshed(func(auth clido.Auth) error {
+		refreshes.Add(1)
+		return nil
+	}))
+
+	var issued = server.Authorize("reed@example.com")
+	client.SetAuth(clido.Auth(issued))
+	server.Revoke(issued.AccessToken)
+
+	var wg sync.WaitGroup
+	var errs = make(chan error, 8)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := client.GetProjects(context.Background()); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("get projects: %v", err)
+	}
+
+	if n := refreshes.Load(); n != 1 {
+		t.Fatalf("got %d refreshes, want 1", n)
+	}
+}
+
+func TestTokenRefreshedCallback(t *testing.T) {
+	var refreshed clido.Auth
+
+	client, server := newTestClient(t, clido.WithTokenRefreshed(func(auth clido.Auth) error {
+		refreshed = auth
+		return nil
+	}))
+
+	var issued = server.Authorize("reed@example.com")
+	client.SetAuth(clido.Auth(issued))
+	server.Revoke(issued.AccessToken)
+
+	if _, err := client.GetProjects(context.Background()); err != nil {
+		t.Fatalf("get projects: %v", err)
+	}
+
+	if refreshed.AccessToken == "" || refreshed.AccessToken == issued.AccessToken {
+		t.Fatalf("expected new credentials, got %+v", refreshed)
+	}
+}
+
+func TestDeviceLogin(t *testing.T) {
+	client, server := newTestClient(t)
+	client.SetPollIntervalUnit(time.Millisecond)
+
+	authorization, err := client.RequestDeviceCode(context.Background())
+
+	if err != nil {
+		t.Fatalf("request device code: %v", err)
+	}
+
+	if authorization.UserCode == "" || authorization.VerificationUri == "" {
+		t.Fatalf("unexpected authorization %+v", authorization)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = server.ApproveDevice(authorization.UserCode, "sso@example.com")
+	}()
+
+	if err := client.PollDeviceToken(context.Background(), authorization); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	if client.Auth().Email != "sso@example.com" || client.Auth().AccessToken == "" {
+		t.Fatalf("unexpected auth %+v", client.Auth())
+	}
+}
+
+func TestDeviceLoginDenied(t *testing.T) {
+	client, server := newTestClient(t)
+	client.SetPollIntervalUnit(time.Millisecond)
+
+	authorization, err := client.RequestDeviceCode(context.Background())
+
+	if err != nil {
+		t.Fatalf("request device code: %v", err)
+	}
+
+	_ = server.DenyDevice(authorization.UserCode)
+
+	if err := client.PollDeviceToken(context.Background(), authorization); !errors.Is(err, clido.ErrAccessDenied) {
+		t.Fatalf("got %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestDeviceLoginCancelled(t *testing.T) {
+	client, _ := newTestClient(t)
+	client.SetPollIntervalUnit(time.Millisecond)
+
+	authorization, err := client.RequestDeviceCode(context.Background())
+
+	if err != nil {
+		t.Fatalf("request device code: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := client.PollDeviceToken(ctx, authorization); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestUpdateTodoIfMatch(t *testing.T) {
+	client, server := newTestClient(t, clido.WithAuth(clido.Auth{}))
+	client.SetAuth(clido.Auth(server.Authorize("reed@example.com")))
+
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	todo, err := client.GetTodo(context.Background(), project.Id, "1")
+
+	// The fake server's ETags are opaque, not version numbers.
+	if err != nil || todo.ETag == "" || strings.Trim(todo.ETag, `"0123456789`) == "" {
+		t.Fatalf("expected an opaque ETag, got %+v, %v", todo, err)
+	}
+
+	var etag = todo.ETag
+
+	if err := client.UpdateTodo(context.Background(), project.Id, "1", clido.UpdateTodo{Todo: todo}); err != nil {
+		t.Fatalf("expected the update with the current ETag to succeed, got %v", err)
+	}
+
+	if todo, err = client.GetTodo(context.Background(), project.Id, "1"); err != nil || todo.ETag == etag {
+		t.Fatalf("expected the update to change the ETag, got %+v, %v", todo, err)
+	}
+
+	_ = server.EditTodo(project.Id, 1, func(todo *clidotest.Todo) { todo.Subject = "Buy oat milk" })
+
+	todo.Subject = "Buy bread"
+
+	if err := client.UpdateTodo(context.Background(), project.Id, "1", clido.UpdateTodo{Todo: todo}); !errors.Is(err, clido.ErrConflict) {
+		t.Fatalf("got %v, want ErrConflict", err)
+	}
+
+	if stored, _ := server.Todo(project.Id, 1); stored.Subject != "Buy oat milk" {
+		t.Fatalf("expected the other change to be kept, got %+v", stored)
+	}
+
+	todo.ETag = ""
+
+	if err := client.UpdateTodo(context.Background(), project.Id, "1", clido.UpdateTodo{Todo: todo}); err != nil {
+		t.Fatalf("expected an update without an ETag to be sent unconditionally, got %v", err)
+	}
+}
+
+func TestDeriveProjectKey(t *testing.T) {
+	var taken = map[string]bool{"OPER": true, "OPER2": true}
+	var cases = map[string]string{"Operations": "OPER3", "my api": "MYAP", "2024 plans": "P2024", "!!": "P", "Ab": "AB"}
+
+	for name, want := range cases {
+		if got := clido.DeriveProjectKey(name, func(key string) bool { return taken[key] }); got != want {
+			t.Errorf("%q: got %q, want %q", name, got, want)
+		}
+	}
+}
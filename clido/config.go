@@ -0,0 +1,13 @@
+package clido
+
+import "time"
+
+func DefaultConfig() Config {
+	return Config{
+		Timeout:          Duration{30 * time.Second},
+		MaxRetries:       3,
+		RetryWaitTime:    Duration{500 * time.Millisecond},
+		RetryMaxWaitTime: Duration{10 * time.Second},
+		CacheTTL:         Duration{time.Minute},
+	}
+}
@@ -0,0 +1,130 @@
+package clido
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Per RFC 8628: poll every 5 seconds unless told otherwise, and back off by
+// another 5 seconds each time the server answers slow_down.
+const (
+	defaultPollInterval = 5
+	slowDownIncrement   = 5
+)
+
+// RequestDeviceCode starts a device authorization. Show the user code and
+// verification URI to the user, then call PollDeviceToken.
+func (api *Client) RequestDeviceCode(ctx context.Context) (DeviceAuthorization, error) {
+	var endpoint = fmt.Sprintf("%s/device/code", api.config.Endpoint)
+	resp, err := api.postNoAuth(ctx, endpoint, DeviceCodeRequest{ClientId: api.config.ClientId}, "Device code")
+
+	if err != nil {
+		return DeviceAuthorization{}, err
+	}
+
+	var authorization DeviceAuthorization
+	err = json.Unmarshal(resp.Body(), &authorization)
+
+	if err != nil {
+		return DeviceAuthorization{}, err
+	}
+
+	return authorization, nil
+}
+
+// PollDeviceToken waits until the user approves the device authorization and
+// then uses the issued credentials. It returns ErrAccessDenied or
+// ErrCodeExpired when the authorization can no longer succeed.
+func (api *Client) PollDeviceToken(ctx context.Context, authorization DeviceAuthorization) error {
+	var endpoint = fmt.Sprintf("%s/token", api.config.Endpoint)
+	var interval = authorization.Interval
+
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	var deadline time.Time
+	if authorization.ExpiresIn > 0 {
+		deadline = time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+	}
+
+	for {
+		if err := api.wait(ctx, time.Duration(interval)*api.pollUnit()); err != nil {
+			return err
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return ErrCodeExpired
+		}
+
+		resp, err := api.postNoAuth(ctx, endpoint, DeviceTokenRequest{
+			GrantType:  DeviceCodeGrantType,
+			DeviceCode: authorization.DeviceCode,
+			ClientId:   api.config.ClientId,
+		}, "Session")
+
+		if err == nil {
+			var auth Auth
+			if err := json.Unmarshal(resp.Body(), &auth); err != nil {
+				return err
+			}
+
+			if auth.CreatedAt == 0 {
+				auth.CreatedAt = int(time.Now().Unix())
+			}
+
+			api.setAuth(auth)
+
+			return nil
+		}
+
+		var apiError *ApiError
+		if !errors.As(err, &apiError) {
+			return err
+		}
+
+		var oauthError struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(resp.Body(), &oauthError)
+
+		switch oauthError.Error {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += slowDownIncrement
+			continue
+		case "access_denied":
+			return ErrAccessDenied
+		case "expired_token":
+			return ErrCodeExpired
+		}
+
+		return err
+	}
+}
+
+func (api *Client) pollUnit() time.Duration {
+	if api.pollIntervalUnit > 0 {
+		return api.pollIntervalUnit
+	}
+
+	return time.Second
+}
+
+func (api *Client) wait(ctx context.Context, d time.Duration) error {
+	var timer = time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,260 @@
+package clido
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation failed")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+
+	ErrAccessDenied = errors.New("login was denied")
+	ErrCodeExpired  = errors.New("login code expired before it was approved")
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ApiError struct {
+	StatusCode  int          `json:"status_code"`
+	Code        string       `json:"code"`
+	Message     string       `json:"message"`
+	FieldErrors []FieldError `json:"errors"`
+	RequestId   string       `json:"request_id"`
+}
+
+func (e *ApiError) Error() string {
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("Cli-do API Error: %s", e.Message))
+
+	if e.Code != "" {
+		builder.WriteString(fmt.Sprintf(" (%s)", e.Code))
+	}
+
+	for _, fieldError := range e.FieldErrors {
+		if fieldError.Field == "" {
+			builder.WriteString(fmt.Sprintf("\n  %s", fieldError.Message))
+		} else {
+			builder.WriteString(fmt.Sprintf("\n  %s: %s", fieldError.Field, fieldError.Message))
+		}
+	}
+
+	if e.RequestId != "" {
+		builder.WriteString(fmt.Sprintf("\nRequest ID: %s", e.RequestId))
+	}
+
+	return builder.String()
+}
+
+func (e *ApiError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict || e.StatusCode == http.StatusPreconditionFailed
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+
+	return false
+}
+
+// CancelledError reports a mutation interrupted by its context. Sent tells
+// whether the request reached the server before cancellation, in which case
+// the change may or may not have been applied.
+type CancelledError struct {
+	Entity string
+	Sent   bool
+	Err    error
+}
+
+func (e *CancelledError) Error() string {
+	if e.Sent {
+		return fmt.Sprintf("%s request cancelled after it was sent; the change may have been applied.", e.Entity)
+	}
+
+	return fmt.Sprintf("%s request cancelled before it was sent; no changes were made.", e.Entity)
+}
+
+func (e *CancelledError) Unwrap() error {
+	return e.Err
+}
+
+func HandleResponseNotOk(resp *resty.Response, entity string) error {
+	if resp.IsSuccess() {
+		return nil
+	}
+
+	var apiError = ParseApiError(resp.Body())
+	apiError.StatusCode = resp.StatusCode()
+
+	if apiError.RequestId == "" {
+		apiError.RequestId = resp.Header().Get("X-Request-Id")
+	}
+
+	if apiError.Message == "" {
+		apiError.Message = defaultErrorMessage(resp.StatusCode(), entity)
+	}
+
+	return apiError
+}
+
+// errorBody covers the error shapes the server produces: a flat object, an
+// object nested under "error", or a bare "error" string, with validation
+// errors either keyed by field or given as a list of messages. OAuth
+// endpoints pair the "error" string with an "error_description".
+type errorBody struct {
+	Code             string          `json:"code"`
+	Message          string          `json:"message"`
+	Error            json.RawMessage `json:"error"`
+	ErrorDescription string          `json:"error_description"`
+	Errors           json.RawMessage `json:"errors"`
+	RequestId        string          `json:"request_id"`
+}
+
+func ParseApiError(body []byte) *ApiError {
+	var apiError = &ApiError{}
+	var parsed errorBody
+
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return apiError
+	}
+
+	apiError.Code = parsed.Code
+	apiError.Message = parsed.Message
+	apiError.RequestId = parsed.RequestId
+	apiError.FieldErrors = parseFieldErrors(parsed.Errors)
+
+	if len(parsed.Error) == 0 {
+		return apiError
+	}
+
+	var message string
+	if err := json.Unmarshal(parsed.Error, &message); err == nil {
+		if parsed.ErrorDescription != "" {
+			if apiError.Code == "" {
+				apiError.Code = message
+			}
+
+			message = parsed.ErrorDescription
+		}
+
+		if apiError.Message == "" {
+			apiError.Message = message
+		}
+
+		return apiError
+	}
+
+	var nested = ParseApiError(parsed.Error)
+
+	if apiError.Code == "" {
+		apiError.Code = nested.Code
+	}
+
+	if apiError.Message == "" {
+		apiError.Message = nested.Message
+	}
+
+	if apiError.RequestId == "" {
+		apiError.RequestId = nested.RequestId
+	}
+
+	if len(apiError.FieldErrors) == 0 {
+		apiError.FieldErrors = nested.FieldErrors
+	}
+
+	return apiError
+}
+
+func parseFieldErrors(raw json.RawMessage) []FieldError {
+	var fieldErrors []FieldError
+
+	if len(raw) == 0 {
+		return fieldErrors
+	}
+
+	var byField map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &byField); err == nil {
+		for field, value := range byField {
+			var messages []string
+			var message string
+
+			if err := json.Unmarshal(value, &messages); err != nil {
+				if err := json.Unmarshal(value, &message); err != nil {
+					continue
+				}
+
+				messages = []string{message}
+			}
+
+			for _, message := range messages {
+				fieldErrors = append(fieldErrors, FieldError{Field: field, Message: message})
+			}
+		}
+
+		sort.SliceStable(fieldErrors, func(i, j int) bool {
+			return fieldErrors[i].Field < fieldErrors[j].Field
+		})
+
+		return fieldErrors
+	}
+
+	var list []FieldError
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+
+	var messages []string
+	if err := json.Unmarshal(raw, &messages); err == nil {
+		for _, message := range messages {
+			fieldErrors = append(fieldErrors, FieldError{Message: message})
+		}
+	}
+
+	return fieldErrors
+}
+
+func defaultErrorMessage(statusCode int, entity string) string {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return fmt.Sprintf("Invalid %s.", strings.ToLower(entity))
+	case http.StatusUnauthorized:
+		return "Not authorized. Please run 'cli-do login --force'."
+	case http.StatusForbidden:
+		return fmt.Sprintf("You do not have access to this %s.", strings.ToLower(entity))
+	case http.StatusNotFound:
+		return fmt.Sprintf("%s not found. Please check the %s's ID.", entity, entity)
+	case http.StatusConflict:
+		return fmt.Sprintf("%s was modified by someone else.", entity)
+	case http.StatusTooManyRequests:
+		return "Too many requests. Please try again later."
+	case http.StatusInternalServerError:
+		return "Internal server error."
+	}
+
+	return http.StatusText(statusCode)
+}
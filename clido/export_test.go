@@ -0,0 +1,14 @@
+package clido
+
+import "time"
+
+// client_test.go is in package clido_test, since clidotest imports clido;
+// these give it the access it needs to a Client's internals.
+
+func (api *Client) SetAuth(auth Auth) {
+	api.setAuth(auth)
+}
+
+func (api *Client) SetPollIntervalUnit(unit time.Duration) {
+	api.pollIntervalUnit = unit
+}
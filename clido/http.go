@@ -0,0 +1,85 @@
+package clido
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func NewHttpClient(config Config) *resty.Client {
+	var client = resty.New().
+		SetTimeout(config.Timeout.Duration).
+		SetRetryCount(config.MaxRetries).
+		SetRetryWaitTime(config.RetryWaitTime.Duration).
+		SetRetryMaxWaitTime(config.RetryMaxWaitTime.Duration).
+		SetRetryAfter(RetryAfter).
+		AddRetryCondition(ShouldRetry)
+
+	return client
+}
+
+// ShouldRetry retries rate limited requests and, for idempotent methods only,
+// transport failures and server errors. A POST that failed half way may
+// already have been applied by the server, so it is never replayed.
+func ShouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+
+	if resp.StatusCode() == http.StatusTooManyRequests {
+		return true
+	}
+
+	if !isIdempotent(resp.Request.Method) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// RetryAfter honors the Retry-After header, in either its delay-seconds or
+// HTTP-date form. Returning zero falls back to resty's jittered backoff.
+func RetryAfter(client *resty.Client, resp *resty.Response) (time.Duration, error) {
+	if resp == nil {
+		return 0, nil
+	}
+
+	var header = resp.Header().Get("Retry-After")
+
+	if header == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date), nil
+	}
+
+	return 0, nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case resty.MethodGet, resty.MethodHead, resty.MethodPut, resty.MethodDelete, resty.MethodOptions:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,99 @@
+package clido
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TodoQuery narrows the todos returned by QueryTodos. It is sent as query
+// parameters, but servers ignore the filters they do not support, so callers
+// should still check each todo with Matches.
+type TodoQuery struct {
+	// All includes completed todos. Completed, when set, overrides it.
+	All       bool
+	Completed *bool
+	Overdue   bool
+	DueBefore *time.Time
+	DueAfter  *time.Time
+	// Text matches the subject or body, ignoring case.
+	Text string
+}
+
+func (query TodoQuery) Values() url.Values {
+	var values = url.Values{}
+	values.Set("all", strconv.FormatBool(query.All || query.Completed != nil))
+
+	if query.Completed != nil {
+		values.Set("completed", strconv.FormatBool(*query.Completed))
+	}
+
+	if query.Overdue {
+		values.Set("overdue", "true")
+	}
+
+	if query.DueBefore != nil {
+		values.Set("due_before", query.DueBefore.Format("2006-01-02"))
+	}
+
+	if query.DueAfter != nil {
+		values.Set("due_after", query.DueAfter.Format("2006-01-02"))
+	}
+
+	if query.Text != "" {
+		values.Set("q", query.Text)
+	}
+
+	return values
+}
+
+// Matches reports whether todo satisfies every filter of the query. Due
+// dates are compared by calendar day, with today taken from now.
+func (query TodoQuery) Matches(todo Todo, now time.Time) bool {
+	if query.Completed != nil {
+		if todo.Completed != *query.Completed {
+			return false
+		}
+	} else if todo.Completed && !query.All {
+		return false
+	}
+
+	if query.Overdue && !todo.IsOverdue(now) {
+		return false
+	}
+
+	if query.DueBefore != nil && (todo.DueDate == nil || !Day(*todo.DueDate).Before(Day(*query.DueBefore))) {
+		return false
+	}
+
+	if query.DueAfter != nil && (todo.DueDate == nil || !Day(*todo.DueDate).After(Day(*query.DueAfter))) {
+		return false
+	}
+
+	if query.Text != "" {
+		var text = strings.ToLower(query.Text)
+
+		if !strings.Contains(strings.ToLower(todo.Subject), text) && !strings.Contains(strings.ToLower(todo.Body), text) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsOverdue reports whether an open todo's due date has passed, trusting
+// the server's PastDue as well as now.
+func (todo Todo) IsOverdue(now time.Time) bool {
+	if todo.Completed || todo.DueDate == nil {
+		return false
+	}
+
+	return todo.PastDue || Day(*todo.DueDate).Before(Day(now))
+}
+
+// Day drops the time of t, keeping the calendar date it shows, so due dates
+// compare by day whatever time zone they were sent in.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
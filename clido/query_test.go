@@ -0,0 +1,40 @@
+package clido
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTodoQueryMatches(t *testing.T) {
+	var now = time.Date(2030, 1, 10, 9, 0, 0, 0, time.Local)
+	var date = func(d int) *time.Time {
+		var due = time.Date(2030, 1, d, 0, 0, 0, 0, time.UTC)
+		return &due
+	}
+	var yes = true
+
+	var cases = []struct {
+		name  string
+		query TodoQuery
+		todo  Todo
+		want  bool
+	}{
+		{"open by default", TodoQuery{}, Todo{}, true},
+		{"completed hidden", TodoQuery{}, Todo{Completed: true}, false},
+		{"all", TodoQuery{All: true}, Todo{Completed: true}, true},
+		{"only completed", TodoQuery{Completed: &yes}, Todo{}, false},
+		{"overdue", TodoQuery{Overdue: true}, Todo{DueDate: date(9)}, true},
+		{"due today is not overdue", TodoQuery{Overdue: true}, Todo{DueDate: date(10)}, false},
+		{"due before", TodoQuery{DueBefore: date(12)}, Todo{DueDate: date(11)}, true},
+		{"due before is exclusive", TodoQuery{DueBefore: date(12)}, Todo{DueDate: date(12)}, false},
+		{"no due date", TodoQuery{DueAfter: date(1)}, Todo{}, false},
+		{"text in body", TodoQuery{Text: "DEPLOY"}, Todo{Body: "deploy the api"}, true},
+		{"text missing", TodoQuery{Text: "deploy"}, Todo{Subject: "Buy milk"}, false},
+	}
+
+	for _, c := range cases {
+		if got := c.query.Matches(c.todo, now); got != c.want {
+			t.Errorf("%s: got %t, want %t", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package clido
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Endpoint         string   `json:"endpoint"`
+	ClientId         string   `json:"client_id"`
+	Timeout          Duration `json:"timeout"`
+	MaxRetries       int      `json:"max_retries"`
+	RetryWaitTime    Duration `json:"retry_wait_time"`
+	RetryMaxWaitTime Duration `json:"retry_max_wait_time"`
+	// CacheTTL is how long the cli-do CLI answers reads from its local cache
+	// before asking the server again. The Client itself does not cache.
+	CacheTTL Duration `json:"cache_ttl"`
+}
+
+// Duration reads either a Go duration string ("30s") or a number of seconds
+// from JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+
+		if err != nil {
+			return err
+		}
+
+		d.Duration = parsed
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+
+	return nil
+}
+
+type Login struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	ClientId string `json:"client_id"`
+}
+
+type Refresh struct {
+	RefreshToken string `json:"refresh_token"`
+	ClientId     string `json:"client_id"`
+	GrantType    string `json:"grant_type"`
+}
+
+type DeviceCodeRequest struct {
+	ClientId string `json:"client_id"`
+}
+
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type DeviceTokenRequest struct {
+	GrantType  string `json:"grant_type"`
+	DeviceCode string `json:"device_code"`
+	ClientId   string `json:"client_id"`
+}
+
+type Revoke struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+	ClientId      string `json:"client_id"`
+}
+
+type Auth struct {
+	Email        string `json:"email"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	CreatedAt    int    `json:"created_at"`
+}
+
+type Todos struct {
+	Todos []Todo `json:"todos"`
+}
+
+type Todo struct {
+	Id        string     `json:"id" yaml:"id"`
+	Subject   string     `json:"subject" yaml:"subject"`
+	Ticket    int        `json:"ticket" yaml:"ticket"`
+	Body      string     `json:"body" yaml:"body"`
+	DueDate   *time.Time `json:"due_date" yaml:"due_date"`
+	Completed bool       `json:"completed" yaml:"completed"`
+	PastDue   bool       `json:"past_due" yaml:"past_due"`
+	// ETag is the entity tag GetTodo was answered with, sent back unchanged
+	// in If-Match by UpdateTodo. Empty when the server does not send one.
+	// It comes from a header, so it is not part of the todo's JSON or YAML.
+	ETag string `json:"-" yaml:"-"`
+}
+
+type CreateTodo struct {
+	Todo Todo `json:"todo"`
+}
+
+type UpdateTodo struct {
+	Todo Todo `json:"todo"`
+}
+
+type Projects struct {
+	Projects []Project `json:"projects"`
+}
+
+type Project struct {
+	Id          string `json:"id" yaml:"id"`
+	Key         string `json:"key,omitempty" yaml:"key,omitempty"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	Ticket      int    `json:"ticket" yaml:"ticket"`
+	Todos       []Todo `json:"todos" yaml:"todos"`
+}
+
+// DeriveProjectKey returns a key for a project called name: the first four
+// letters and digits of the name, upper cased and starting with a letter,
+// numbered from 2 while taken reports the key as in use.
+func DeriveProjectKey(name string, taken func(key string) bool) string {
+	var base = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+
+		return -1
+	}, name)
+
+	if len(base) > 4 {
+		base = base[:4]
+	}
+
+	if base == "" || base[0] < 'A' || base[0] > 'Z' {
+		base = "P" + base
+	}
+
+	var key = base
+
+	for n := 2; taken(key); n++ {
+		key = fmt.Sprintf("%s%d", base, n)
+	}
+
+	return key
+}
+
+type CreateProject struct {
+	Project Project `json:"project"`
+}
@@ -0,0 +1,939 @@
+// Package clidotest provides an in-memory cli-do server for tests.
+//
+// The server speaks the same JSON as the real API, so a client pointed at
+// Server.URL can log in, manage projects and todos, and see the same status
+// codes it would in production without any network access.
+package clidotest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+)
+
+// TokenLifetime is the expires_in, in seconds, of every token the server
+// issues.
+const TokenLifetime = 3600
+
+// DeviceInterval and DeviceCodeLifetime are the interval and expires_in, in
+// seconds, of device authorizations.
+const (
+	DeviceInterval     = 1
+	DeviceCodeLifetime = 600
+)
+
+type Auth struct {
+	Email        string `json:"email"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	CreatedAt    int    `json:"created_at"`
+}
+
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type deviceGrant struct {
+	userCode  string
+	email     string
+	denied    bool
+	expiresAt time.Time
+	lastPoll  time.Time
+	interval  time.Duration
+}
+
+type Project struct {
+	Id          string `json:"id"`
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Ticket      int    `json:"ticket"`
+	Todos       []Todo `json:"todos"`
+	Archived    bool   `json:"-"`
+}
+
+type Todo struct {
+	Id        string     `json:"id"`
+	Subject   string     `json:"subject"`
+	Ticket    int        `json:"ticket"`
+	Body      string     `json:"body"`
+	DueDate   *time.Time `json:"due_date"`
+	Completed bool       `json:"completed"`
+	PastDue   bool       `json:"past_due"`
+	Version   int        `json:"-"`
+	Archived  bool       `json:"-"`
+}
+
+// Server is a fake cli-do API backed by memory. All methods are safe for
+// concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	users         map[string]string
+	accessTokens  map[string]string
+	refreshTokens map[string]string
+	projects      []*Project
+	todos         map[string][]*Todo
+	devices       map[string]*deviceGrant
+	failures      []int
+	delays        []time.Duration
+	requests      int
+}
+
+// NewServer starts a fake server. Callers should Close it when done.
+func NewServer() *Server {
+	var s = &Server{
+		users:         map[string]string{},
+		accessTokens:  map[string]string{},
+		refreshTokens: map[string]string{},
+		todos:         map[string][]*Todo{},
+		devices:       map[string]*deviceGrant{},
+	}
+
+	var mux = http.NewServeMux()
+
+	mux.HandleFunc("POST /login", s.handleLogin)
+	mux.HandleFunc("POST /refresh", s.handleRefresh)
+	mux.HandleFunc("POST /revoke", s.handleRevoke)
+	mux.HandleFunc("POST /device/code", s.handleDeviceCode)
+	mux.HandleFunc("POST /token", s.handleToken)
+	mux.HandleFunc("GET /projects", s.authenticated(s.handleListProjects))
+	mux.HandleFunc("POST /projects", s.authenticated(s.handleCreateProject))
+	mux.HandleFunc("GET /projects/{project}", s.authenticated(s.handleGetProject))
+	mux.HandleFunc("DELETE /projects/{project}", s.authenticated(s.handleArchiveProject))
+	mux.HandleFunc("GET /projects/{project}/todos", s.authenticated(s.handleListTodos))
+	mux.HandleFunc("POST /projects/{project}/todos", s.authenticated(s.handleCreateTodo))
+	mux.HandleFunc("GET /projects/{project}/todos/{ticket}", s.authenticated(s.handleGetTodo))
+	mux.HandleFunc("PUT /projects/{project}/todos/{ticket}", s.authenticated(s.handleUpdateTodo))
+	mux.HandleFunc("DELETE /projects/{project}/todos/{ticket}", s.authenticated(s.handleArchiveTodo))
+	mux.HandleFunc("POST /projects/{project}/todos/{ticket}/complete", s.authenticated(s.handleCompleteTodo))
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+
+	return s
+}
+
+// AddUser registers an account that can log in with the given password.
+func (s *Server) AddUser(email string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[email] = password
+}
+
+// Authorize issues credentials for email without going through /login.
+func (s *Server) Authorize(email string) Auth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.issue(email)
+}
+
+// Revoke invalidates an access token, as if it had expired server side.
+func (s *Server) Revoke(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.accessTokens, accessToken)
+}
+
+// Revoked reports whether token is no longer accepted by the server.
+func (s *Server) Revoked(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, access := s.accessTokens[token]
+	_, refresh := s.refreshTokens[token]
+
+	return !access && !refresh
+}
+
+// PendingUserCodes lists the user codes of device authorizations that are
+// still waiting for approval.
+func (s *Server) PendingUserCodes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var codes []string
+
+	for _, grant := range s.devices {
+		if grant.email == "" && !grant.denied {
+			codes = append(codes, grant.userCode)
+		}
+	}
+
+	sort.Strings(codes)
+
+	return codes
+}
+
+// ApproveDevice signs email in on the device showing userCode, as if the user
+// had confirmed it in their browser.
+func (s *Server) ApproveDevice(userCode string, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var grant = s.findDevice(userCode)
+
+	if grant == nil {
+		return fmt.Errorf("device code %s not found", userCode)
+	}
+
+	grant.email = email
+
+	return nil
+}
+
+// DenyDevice rejects the device authorization showing userCode.
+func (s *Server) DenyDevice(userCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var grant = s.findDevice(userCode)
+
+	if grant == nil {
+		return fmt.Errorf("device code %s not found", userCode)
+	}
+
+	grant.denied = true
+
+	return nil
+}
+
+// AddProject creates a project directly, bypassing the API. Its key is
+// derived from the name.
+func (s *Server) AddProject(name string, description string) Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createProject(name, description, "").view(nil)
+}
+
+// AddTodo creates a todo in projectId directly, bypassing the API. Ticket and
+// Id are assigned by the server.
+func (s *Server) AddTodo(projectId string, todo Todo) (Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findProject(projectId) == nil {
+		return Todo{}, fmt.Errorf("project %s not found", projectId)
+	}
+
+	return s.createTodo(projectId, todo).view(), nil
+}
+
+// Project returns the stored project, including archived ones.
+func (s *Server) Project(projectId string) (Project, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var project = s.findProject(projectId)
+
+	if project == nil {
+		return Project{}, false
+	}
+
+	return project.view(s.todos[project.Id]), true
+}
+
+// Todo returns the stored todo, including archived ones.
+func (s *Server) Todo(projectId string, ticket int) (Todo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var todo = s.findTodo(projectId, ticket)
+
+	if todo == nil {
+		return Todo{}, false
+	}
+
+	return todo.view(), true
+}
+
+// EditTodo changes a stored todo directly, bypassing the API, as another
+// client would. Its version is bumped.
+func (s *Server) EditTodo(projectId string, ticket int, edit func(todo *Todo)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var todo = s.findTodo(projectId, ticket)
+
+	if todo == nil {
+		return fmt.Errorf("todo %d not found in %s", ticket, projectId)
+	}
+
+	edit(todo)
+	todo.Version++
+
+	return nil
+}
+
+// FailNext makes the next len(statuses) requests fail with the given status
+// codes, in order, before they reach a handler. A zero status lets that
+// request through untouched.
+func (s *Server) FailNext(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, statuses...)
+}
+
+// SlowNext makes the next len(delays) requests wait for the given delays
+// after they were handled, before the response is sent, like a server that
+// applied a change but answered too late. A zero delay answers at once.
+func (s *Server) SlowNext(delays ...time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delays = append(s.delays, delays...)
+}
+
+// Requests reports how many requests the server has received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", newId())
+
+		s.mu.Lock()
+		s.requests++
+
+		var status = 0
+		if len(s.failures) > 0 {
+			status = s.failures[0]
+			s.failures = s.failures[1:]
+		}
+
+		var delay time.Duration
+		if len(s.delays) > 0 {
+			delay = s.delays[0]
+			s.delays = s.delays[1:]
+		}
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, status, strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")), http.StatusText(status))
+			return
+		}
+
+		// The response stays buffered until the handler returns.
+		next.ServeHTTP(w, r)
+		time.Sleep(delay)
+	})
+}
+
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mu.Lock()
+		_, ok := s.accessTokens[token]
+		s.mu.Unlock()
+
+		if token == "" || !ok {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid or expired access token.")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var login struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if !readJson(w, r, &login) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	password, ok := s.users[login.Email]
+
+	if !ok || password != login.Password {
+		writeError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid email or password.")
+		return
+	}
+
+	writeJson(w, http.StatusOK, s.issue(login.Email))
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var refresh struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if !readJson(w, r, &refresh) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email, ok := s.refreshTokens[refresh.RefreshToken]
+
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_grant", "Invalid refresh token.")
+		return
+	}
+
+	delete(s.refreshTokens, refresh.RefreshToken)
+
+	writeJson(w, http.StatusOK, s.issue(email))
+}
+
+// handleRevoke follows RFC 7009: unknown tokens are ignored and the response
+// is always 200.
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	var revoke struct {
+		Token string `json:"token"`
+	}
+
+	if !readJson(w, r, &revoke) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.accessTokens, revoke.Token)
+	delete(s.refreshTokens, revoke.Token)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleDeviceCode(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deviceCode = newId()
+	var userCode = strings.ToUpper(deviceCode[0:4] + "-" + deviceCode[4:8])
+
+	s.devices[deviceCode] = &deviceGrant{
+		userCode:  userCode,
+		expiresAt: time.Now().Add(DeviceCodeLifetime * time.Second),
+		interval:  DeviceInterval * time.Second,
+	}
+
+	var verificationUri = s.URL + "/device"
+
+	writeJson(w, http.StatusOK, DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationUri:         verificationUri,
+		VerificationUriComplete: verificationUri + "?user_code=" + userCode,
+		ExpiresIn:               DeviceCodeLifetime,
+		Interval:                DeviceInterval,
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	var token struct {
+		GrantType  string `json:"grant_type"`
+		DeviceCode string `json:"device_code"`
+	}
+
+	if !readJson(w, r, &token) {
+		return
+	}
+
+	if token.GrantType != "urn:ietf:params:oauth:grant-type:device_code" {
+		writeOAuthError(w, "unsupported_grant_type", "Only the device code grant is supported.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, ok := s.devices[token.DeviceCode]
+
+	switch {
+	case !ok:
+		writeOAuthError(w, "invalid_grant", "Unknown device code.")
+	case time.Now().After(grant.expiresAt):
+		writeOAuthError(w, "expired_token", "The device code has expired.")
+	case grant.denied:
+		delete(s.devices, token.DeviceCode)
+		writeOAuthError(w, "access_denied", "The user denied the request.")
+	case grant.email != "":
+		delete(s.devices, token.DeviceCode)
+		writeJson(w, http.StatusOK, s.issue(grant.email))
+	case time.Since(grant.lastPoll) < grant.interval/2:
+		// Polling far faster than asked earns a slow_down, which also
+		// lengthens the interval the client must respect.
+		grant.lastPoll = time.Now()
+		grant.interval += 5 * time.Second
+		writeOAuthError(w, "slow_down", "Polling too frequently.")
+	default:
+		grant.lastPoll = time.Now()
+		writeOAuthError(w, "authorization_pending", "Waiting for the user to approve the request.")
+	}
+}
+
+func (s *Server) handleListProjects(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var projects = []Project{}
+
+	for _, project := range s.projects {
+		if !project.Archived {
+			projects = append(projects, project.view(nil))
+		}
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"projects": projects})
+}
+
+func (s *Server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Project Project `json:"project"`
+	}
+
+	if !readJson(w, r, &body) {
+		return
+	}
+
+	if strings.TrimSpace(body.Project.Name) == "" {
+		writeValidationError(w, "name", "can't be blank")
+		return
+	}
+
+	if body.Project.Key == "" {
+		writeValidationError(w, "key", "can't be blank")
+		return
+	}
+
+	if !projectKeyRegex.MatchString(body.Project.Key) {
+		writeValidationError(w, "key", "must be uppercase letters and digits, starting with a letter")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findProjectByKey(body.Project.Key) != nil {
+		writeValidationError(w, "key", "has already been taken")
+		return
+	}
+
+	writeJson(w, http.StatusCreated, s.createProject(body.Project.Name, body.Project.Description, body.Project.Key).view(nil))
+}
+
+func (s *Server) handleGetProject(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var project = s.activeProject(w, r)
+
+	if project == nil {
+		return
+	}
+
+	writeJson(w, http.StatusOK, project.view(s.todos[project.Id]))
+}
+
+func (s *Server) handleArchiveProject(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var project = s.activeProject(w, r)
+
+	if project == nil {
+		return
+	}
+
+	project.Archived = true
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListTodos(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var project = s.activeProject(w, r)
+
+	if project == nil {
+		return
+	}
+
+	// Of the list filters the fake server only understands all, completed
+	// and q, so clients have to apply the others themselves.
+	var query = r.URL.Query()
+	var all, _ = strconv.ParseBool(query.Get("all"))
+	var text = strings.ToLower(query.Get("q"))
+	var todos = []Todo{}
+
+	for _, todo := range s.todos[project.Id] {
+		if todo.Archived || (todo.Completed && !all) {
+			continue
+		}
+
+		if completed, err := strconv.ParseBool(query.Get("completed")); err == nil && todo.Completed != completed {
+			continue
+		}
+
+		if text != "" && !strings.Contains(strings.ToLower(todo.Subject), text) && !strings.Contains(strings.ToLower(todo.Body), text) {
+			continue
+		}
+
+		todos = append(todos, todo.view())
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"todos": todos})
+}
+
+func (s *Server) handleCreateTodo(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Todo Todo `json:"todo"`
+	}
+
+	if !readJson(w, r, &body) {
+		return
+	}
+
+	if strings.TrimSpace(body.Todo.Subject) == "" {
+		writeValidationError(w, "subject", "can't be blank")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var project = s.activeProject(w, r)
+
+	if project == nil {
+		return
+	}
+
+	writeJson(w, http.StatusCreated, s.createTodo(project.Id, body.Todo).view())
+}
+
+func (s *Server) handleGetTodo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var todo = s.activeTodo(w, r)
+
+	if todo == nil {
+		return
+	}
+
+	w.Header().Set("ETag", todo.etag())
+	writeJson(w, http.StatusOK, todo.view())
+}
+
+func (s *Server) handleUpdateTodo(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Todo Todo `json:"todo"`
+	}
+
+	if !readJson(w, r, &body) {
+		return
+	}
+
+	if strings.TrimSpace(body.Todo.Subject) == "" {
+		writeValidationError(w, "subject", "can't be blank")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var todo = s.activeTodo(w, r)
+
+	if todo == nil {
+		return
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != todo.etag() {
+		writeError(w, http.StatusPreconditionFailed, "conflict", "The todo was changed since it was read.")
+		return
+	}
+
+	todo.Subject = body.Todo.Subject
+	todo.Body = body.Todo.Body
+	todo.DueDate = body.Todo.DueDate
+	todo.Completed = body.Todo.Completed
+	todo.Version++
+
+	writeJson(w, http.StatusOK, todo.view())
+}
+
+func (s *Server) handleArchiveTodo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var todo = s.activeTodo(w, r)
+
+	if todo == nil {
+		return
+	}
+
+	todo.Archived = true
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCompleteTodo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var todo = s.activeTodo(w, r)
+
+	if todo == nil {
+		return
+	}
+
+	todo.Completed = true
+	todo.Version++
+
+	writeJson(w, http.StatusOK, todo.view())
+}
+
+// issue must be called with s.mu held.
+func (s *Server) issue(email string) Auth {
+	var auth = Auth{
+		Email:        email,
+		AccessToken:  newId(),
+		TokenType:    "Bearer",
+		ExpiresIn:    TokenLifetime,
+		RefreshToken: newId(),
+		CreatedAt:    int(time.Now().Unix()),
+	}
+
+	s.accessTokens[auth.AccessToken] = email
+	s.refreshTokens[auth.RefreshToken] = email
+
+	return auth
+}
+
+// createProject stores a new project. Without a key one is derived from the
+// name as the client does, for projects added directly; the API requires
+// clients to send one.
+func (s *Server) createProject(name string, description string, key string) *Project {
+	if key == "" {
+		key = clido.DeriveProjectKey(name, func(key string) bool {
+			return s.findProjectByKey(key) != nil
+		})
+	}
+
+	var project = &Project{
+		Id:          newId(),
+		Key:         key,
+		Name:        name,
+		Description: description,
+		Ticket:      len(s.projects) + 1,
+	}
+
+	s.projects = append(s.projects, project)
+
+	return project
+}
+
+func (s *Server) createTodo(projectId string, todo Todo) *Todo {
+	var created = &Todo{
+		Id:        newId(),
+		Subject:   todo.Subject,
+		Ticket:    len(s.todos[projectId]) + 1,
+		Body:      todo.Body,
+		DueDate:   todo.DueDate,
+		Completed: todo.Completed,
+		Version:   1,
+	}
+
+	s.todos[projectId] = append(s.todos[projectId], created)
+
+	return created
+}
+
+func (s *Server) findProject(projectId string) *Project {
+	for _, project := range s.projects {
+		if project.Id == projectId {
+			return project
+		}
+	}
+
+	return nil
+}
+
+// findProjectByKey returns the active project with key. Archiving a project
+// frees its key.
+func (s *Server) findProjectByKey(key string) *Project {
+	for _, project := range s.projects {
+		if project.Key == key && !project.Archived {
+			return project
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) findDevice(userCode string) *deviceGrant {
+	for _, grant := range s.devices {
+		if grant.userCode == userCode {
+			return grant
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) findTodo(projectId string, ticket int) *Todo {
+	for _, todo := range s.todos[projectId] {
+		if todo.Ticket == ticket {
+			return todo
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) activeProject(w http.ResponseWriter, r *http.Request) *Project {
+	var project = s.findProject(r.PathValue("project"))
+
+	if project == nil || project.Archived {
+		writeError(w, http.StatusNotFound, "not_found", "Project not found.")
+		return nil
+	}
+
+	return project
+}
+
+func (s *Server) activeTodo(w http.ResponseWriter, r *http.Request) *Todo {
+	var project = s.activeProject(w, r)
+
+	if project == nil {
+		return nil
+	}
+
+	ticket, err := strconv.Atoi(r.PathValue("ticket"))
+	var todo *Todo
+
+	if err == nil {
+		todo = s.findTodo(project.Id, ticket)
+	}
+
+	if todo == nil || todo.Archived {
+		writeError(w, http.StatusNotFound, "not_found", "Todo not found.")
+		return nil
+	}
+
+	return todo
+}
+
+func (project *Project) view(todos []*Todo) Project {
+	var view = *project
+	view.Todos = []Todo{}
+
+	for _, todo := range todos {
+		if !todo.Archived {
+			view.Todos = append(view.Todos, todo.view())
+		}
+	}
+
+	sort.SliceStable(view.Todos, func(i, j int) bool {
+		return view.Todos[i].Ticket < view.Todos[j].Ticket
+	})
+
+	return view
+}
+
+// etag is an opaque tag for the current version of the todo, so clients
+// cannot rely on it being a number.
+func (todo *Todo) etag() string {
+	var sum = sha256.Sum256([]byte(fmt.Sprintf("%s/%d", todo.Id, todo.Version)))
+
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+func (todo *Todo) view() Todo {
+	var view = *todo
+	view.PastDue = !todo.Completed && todo.DueDate != nil && todo.DueDate.Before(time.Now())
+
+	return view
+}
+
+func readJson(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("Malformed request body: %s", err))
+		return false
+	}
+
+	return true
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJson(w, status, map[string]interface{}{
+		"error": map[string]string{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+func writeOAuthError(w http.ResponseWriter, code string, description string) {
+	writeJson(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeValidationError(w http.ResponseWriter, field string, message string) {
+	writeJson(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"code":    "validation_failed",
+		"message": "Validation failed.",
+		"errors":  map[string][]string{field: {message}},
+	})
+}
+
+var projectKeyRegex = regexp.MustCompile(`^[A-Z][A-Z0-9]*$`)
+
+func newId() string {
+	var b = make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	var h = hex.EncodeToString(b)
+
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32])
+}
@@ -3,16 +3,19 @@ module github.com/streed/cli-do-client
 go 1.22.5
 
 require (
-	github.com/aquilax/truncate v1.0.0 // indirect
+	github.com/aquilax/truncate v1.0.0
+	github.com/go-resty/resty/v2 v2.13.1
+	github.com/rodaine/table v1.2.0
+	github.com/urfave/cli/v2 v2.27.2
+	golang.org/x/crypto v0.25.0
+	golang.org/x/term v0.22.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.4 // indirect
-	github.com/go-resty/resty/v2 v2.13.1 // indirect
-	github.com/rodaine/table v1.2.0 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
-	github.com/urfave/cli v1.22.15 // indirect
-	github.com/urfave/cli/v2 v2.27.2 // indirect
 	github.com/xrash/smetrics v0.0.0-20240312152122-5f08fbb34913 // indirect
-	golang.org/x/crypto v0.25.0 // indirect
 	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
-	golang.org/x/term v0.22.0 // indirect
 )
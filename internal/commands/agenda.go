@@ -0,0 +1,322 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aquilax/truncate"
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// AgendaWorkers bounds how many projects are listed at the same time.
+const AgendaWorkers = 4
+
+// Agenda groups, in the order they are shown.
+const (
+	AgendaOverdue   = "overdue"
+	AgendaToday     = "today"
+	AgendaThisWeek  = "this week"
+	AgendaLater     = "later"
+	AgendaNoDueDate = "no due date"
+)
+
+var agendaGroups = []string{AgendaOverdue, AgendaToday, AgendaThisWeek, AgendaLater, AgendaNoDueDate}
+
+// AgendaItem is a todo together with the project it belongs to.
+type AgendaItem struct {
+	Group      string `json:"group" yaml:"group"`
+	Ref        string `json:"ref" yaml:"ref"`
+	Project    string `json:"project" yaml:"project"`
+	ProjectId  string `json:"project_id" yaml:"project_id"`
+	clido.Todo `yaml:",inline"`
+}
+
+func HandleAgenda(ctx *cli.Context) error {
+	query, err := TodoQueryFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projects, err := api.GetProjects(ctx.Context)
+
+	if err != nil {
+		return err
+	}
+
+	items, err := ListAgenda(ctx.Context, api, projects.Projects, query, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	return AgendaOutput(items).Render(ctx)
+}
+
+// ListAgenda lists the todos matching query in every project and arranges
+// them with NewAgenda.
+func ListAgenda(ctx context.Context, api clido.Api, projects []clido.Project, query clido.TodoQuery, now time.Time) ([]AgendaItem, error) {
+	todos, err := ListProjectTodos(ctx, api, projects, query, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAgenda(todos, now), nil
+}
+
+// ProjectTodo is a todo together with the project it belongs to.
+type ProjectTodo struct {
+	Project clido.Project
+	Todo    clido.Todo
+}
+
+// ListProjectTodos lists the todos matching query in every project, at most
+// AgendaWorkers at a time, keeping the order of projects. The first failure
+// cancels the requests still running.
+func ListProjectTodos(ctx context.Context, api clido.Api, projects []clido.Project, query clido.TodoQuery, now time.Time) ([]ProjectTodo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var jobs = make(chan int)
+	var results = make([][]ProjectTodo, len(projects))
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < AgendaWorkers && w < len(projects); w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				var project = projects[i]
+				todos, err := api.QueryTodos(ctx, project.Id, query)
+
+				if err != nil {
+					mu.Lock()
+
+					if firstErr == nil {
+						firstErr = fmt.Errorf("unable to list the todos of %s: %w", project.Name, err)
+						cancel()
+					}
+
+					mu.Unlock()
+
+					continue
+				}
+
+				for _, todo := range FilterTodos(todos.Todos, query, now) {
+					results[i] = append(results[i], ProjectTodo{Project: project, Todo: todo})
+				}
+			}
+		}()
+	}
+
+	for i := range projects {
+		if ctx.Err() != nil {
+			break
+		}
+
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var todos = []ProjectTodo{}
+
+	for _, result := range results {
+		todos = append(todos, result...)
+	}
+
+	return todos, nil
+}
+
+// NewAgenda groups todos by due date and sorts them by group, due date and
+// project.
+func NewAgenda(todos []ProjectTodo, now time.Time) []AgendaItem {
+	var items = make([]AgendaItem, 0, len(todos))
+
+	for _, todo := range todos {
+		items = append(items, AgendaItem{
+			Group:     AgendaGroup(todo.Todo, now),
+			Ref:       TodoRef(todo.Project, todo.Todo),
+			Project:   todo.Project.Name,
+			ProjectId: todo.Project.Id,
+			Todo:      todo.Todo,
+		})
+	}
+
+	var rank = map[string]int{}
+
+	for i, group := range agendaGroups {
+		rank[group] = i
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if rank[items[i].Group] != rank[items[j].Group] {
+			return rank[items[i].Group] < rank[items[j].Group]
+		}
+
+		if items[i].DueDate != nil && items[j].DueDate != nil && !items[i].DueDate.Equal(*items[j].DueDate) {
+			return items[i].DueDate.Before(*items[j].DueDate)
+		}
+
+		return false
+	})
+
+	return items
+}
+
+// AgendaGroup places a todo by its due date relative to now. This week is
+// the six days after today. Completed todos due before today are grouped
+// with the overdue ones.
+func AgendaGroup(todo clido.Todo, now time.Time) string {
+	if todo.DueDate == nil {
+		return AgendaNoDueDate
+	}
+
+	var due = clido.Day(*todo.DueDate)
+	var today = clido.Day(now)
+
+	switch {
+	case todo.IsOverdue(now) || due.Before(today):
+		return AgendaOverdue
+	case due.Equal(today):
+		return AgendaToday
+	case due.Before(today.AddDate(0, 0, 7)):
+		return AgendaThisWeek
+	}
+
+	return AgendaLater
+}
+
+// TodoRef is the global reference of a todo, such as PROJ-42, or its bare
+// ticket when the project has no key.
+func TodoRef(project clido.Project, todo clido.Todo) string {
+	if project.Key == "" {
+		return strconv.Itoa(todo.Ticket)
+	}
+
+	return fmt.Sprintf("%s-%d", project.Key, todo.Ticket)
+}
+
+func AgendaOutput(items []AgendaItem) Output {
+	var rows = make([]interface{}, 0, len(items))
+
+	for _, item := range items {
+		rows = append(rows, item)
+	}
+
+	return Output{
+		Value:   items,
+		Items:   rows,
+		Columns: AgendaColumns(),
+		Record:  AgendaRecord,
+		Table: func(w io.Writer) {
+			PrintAgendaTable(w, items)
+		},
+	}
+}
+
+func AgendaColumns() []string {
+	return []string{"group", "ref", "project", "subject", "due_date", "completed"}
+}
+
+func AgendaRecord(item interface{}) []string {
+	var agendaItem = item.(AgendaItem)
+	var dueDate string
+
+	if agendaItem.DueDate != nil {
+		dueDate = agendaItem.DueDate.Format("2006-01-02")
+	}
+
+	return []string{
+		agendaItem.Group,
+		agendaItem.Ref,
+		agendaItem.Project,
+		agendaItem.Subject,
+		dueDate,
+		strconv.FormatBool(agendaItem.Completed),
+	}
+}
+
+// PrintAgendaTable prints one table per group that has todos.
+func PrintAgendaTable(w io.Writer, items []AgendaItem) {
+	var first = true
+
+	for _, group := range agendaGroups {
+		var tbl table.Table
+
+		for _, item := range items {
+			if item.Group != group {
+				continue
+			}
+
+			if tbl == nil {
+				if !first {
+					fmt.Fprintln(w)
+				}
+
+				fmt.Fprintf(w, "%s\n", agendaTitle(group))
+				tbl = table.New("Ref", "Project", "Subject", "Due Date", "Completed").WithWriter(w)
+				first = false
+			}
+
+			var dueDate = "-"
+
+			if item.DueDate != nil {
+				dueDate = item.DueDate.Format("2006-01-02")
+			}
+
+			var truncatedSubject = truncate.Truncate(item.Subject, 40, "...", truncate.PositionEnd)
+			tbl.AddRow(item.Ref, item.Project, truncatedSubject, dueDate, item.Completed)
+		}
+
+		if tbl != nil {
+			tbl.Print()
+		}
+	}
+
+	if first {
+		fmt.Fprintln(w, "Nothing on the agenda.")
+	}
+}
+
+func agendaTitle(group string) string {
+	switch group {
+	case AgendaOverdue:
+		return "Overdue"
+	case AgendaToday:
+		return "Today"
+	case AgendaThisWeek:
+		return "This week"
+	case AgendaLater:
+		return "Later"
+	}
+
+	return "No due date"
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func TestAgendaGroup(t *testing.T) {
+	var now = time.Date(2030, 1, 10, 15, 0, 0, 0, time.Local)
+	var day = func(offset int) *time.Time {
+		var due = time.Date(2030, 1, 10+offset, 0, 0, 0, 0, time.UTC)
+		return &due
+	}
+
+	var cases = []struct {
+		todo clido.Todo
+		want string
+	}{
+		{clido.Todo{}, AgendaNoDueDate},
+		{clido.Todo{DueDate: day(-1)}, AgendaOverdue},
+		{clido.Todo{DueDate: day(0), PastDue: true}, AgendaOverdue},
+		{clido.Todo{DueDate: day(0)}, AgendaToday},
+		{clido.Todo{DueDate: day(6)}, AgendaThisWeek},
+		{clido.Todo{DueDate: day(7)}, AgendaLater},
+	}
+
+	for _, c := range cases {
+		if got := AgendaGroup(c.todo, now); got != c.want {
+			t.Errorf("%v: got %q, want %q", c.todo.DueDate, got, c.want)
+		}
+	}
+}
+
+func TestHandleAgenda(t *testing.T) {
+	var server = setup(t)
+	var today = time.Now()
+	var yesterday = time.Date(today.Year(), today.Month(), today.Day()-1, 0, 0, 0, 0, time.UTC)
+	var nextMonth = time.Date(today.Year(), today.Month(), today.Day()+30, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2*AgendaWorkers+1; i++ {
+		var project = server.AddProject(fmt.Sprintf("Project %d", i), "")
+
+		_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: fmt.Sprintf("Later %d", i), DueDate: &nextMonth})
+		_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: fmt.Sprintf("Someday %d", i)})
+		_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: fmt.Sprintf("Done %d", i), Completed: true})
+	}
+
+	var late = server.AddProject("Late", "")
+	_, _ = server.AddTodo(late.Id, clidotest.Todo{Subject: "Overdue", DueDate: &yesterday})
+
+	out, err := run(t, "-o", "json", "agenda")
+
+	if err != nil {
+		t.Fatalf("agenda: %v", err)
+	}
+
+	var items []AgendaItem
+
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+
+	if len(items) != 2*(2*AgendaWorkers+1)+1 {
+		t.Fatalf("got %d items, want every open todo", len(items))
+	}
+
+	if items[0].Group != AgendaOverdue || items[0].Project != "Late" || items[0].Ref != late.Key+"-1" {
+		t.Fatalf("expected the overdue todo first, got %+v", items[0])
+	}
+
+	if last := items[len(items)-1]; last.Group != AgendaNoDueDate {
+		t.Fatalf("expected todos without a due date last, got %+v", last)
+	}
+
+	out, err = run(t, "todo", "list", "--all", "--all-projects")
+
+	if err != nil {
+		t.Fatalf("todo list --all-projects: %v", err)
+	}
+
+	for _, want := range []string{"Overdue", "Later", "No due date", "Done 0", "Project 8"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+
+	server.FailNext(0, http.StatusNotFound)
+
+	if _, err := run(t, "agenda"); ExitCode(err) != ExitNotFound {
+		t.Fatalf("got %v, want the failed project's error", err)
+	}
+}
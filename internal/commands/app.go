@@ -0,0 +1,456 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// NewApp builds the cli-do command tree. Errors are returned rather than
+// reported, so the caller decides the exit code with ExitCode.
+func NewApp() *cli.App {
+	var app = &cli.App{
+		Name:    "cli-do",
+		Usage:   "A CLI for CLI Do",
+		Version: "0.1.0",
+		Authors: []*cli.Author{
+			{
+				Name:  "Reed",
+				Email: "support@cli-do.com",
+			},
+		},
+		Compiled:             time.Now(),
+		EnableBashCompletion: true,
+		OnUsageError:         HandleUsageError,
+		Before:               MigrateLegacyAuth,
+		// Errors are reported by the caller so the exit code follows ExitCode.
+		ExitErrHandler: func(*cli.Context, error) {},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "project",
+				Aliases: []string{"p"},
+				Usage:   "Project ID, ticket number or name",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "Named profile to use instead of the active one",
+				EnvVars: []string{"CLI_DO_PROFILE"},
+			},
+			&cli.StringFlag{
+				Name:  "endpoint",
+				Usage: "API endpoint, overriding the config files and CLI_DO_ENDPOINT",
+			},
+			&cli.StringFlag{
+				Name:  "client-id",
+				Usage: "OAuth client ID, overriding the config files and CLI_DO_CLIENT_ID",
+			},
+			&cli.StringFlag{
+				Name:  "timeout",
+				Usage: "Request timeout such as 30s, overriding the config files and CLI_DO_TIMEOUT",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output format: table, json, jsonl, yaml, csv, tsv or template",
+				Value:   OutputTable,
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "Go template applied to each item, e.g. '{{.Ticket}} {{.Subject}}'",
+			},
+			&cli.BoolFlag{
+				Name:    "verbose",
+				Usage:   "Report which project file and settings are used",
+				EnvVars: []string{"CLI_DO_VERBOSE"},
+			},
+			&cli.BoolFlag{
+				Name:    "offline",
+				Usage:   "Answer from the local cache without contacting the server",
+				EnvVars: []string{"CLI_DO_OFFLINE"},
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:    "login",
+				Aliases: []string{"l"},
+				Usage:   "Login to cli-do",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "force",
+						Usage:   "Force to refresh login if already logged in",
+						Aliases: []string{"f"},
+					},
+					&cli.StringFlag{
+						Name:    "email",
+						Aliases: []string{"e"},
+						Usage:   "Email to log in with",
+						EnvVars: []string{"CLI_DO_EMAIL"},
+					},
+					&cli.BoolFlag{
+						Name:  "password-stdin",
+						Usage: "Read the password from stdin, requires --email",
+					},
+					&cli.BoolFlag{
+						Name:  "device",
+						Usage: "Log in through the browser with a one-time code, for SSO accounts",
+					},
+					&cli.BoolFlag{
+						Name:  "token-stdin",
+						Usage: "Read a personal access token from stdin instead of logging in with a password",
+					},
+				},
+				Action: HandleLogin,
+			},
+			{
+				Name:  "logout",
+				Usage: "Revoke the session and remove saved credentials",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "force",
+						Usage:   "Log out even if queued offline changes have not been synced, dropping them",
+						Aliases: []string{"f"},
+					},
+				},
+				Action: HandleLogout,
+			},
+			{
+				Name:  "auth",
+				Usage: "Inspect the saved credentials",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "status",
+						Usage:  "Show the account, endpoint and token expiry of the active profile",
+						Action: HandleAuthStatus,
+					},
+					{
+						Name:   "token",
+						Usage:  "Print the access token for use in scripts",
+						Action: HandleAuthToken,
+					},
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "Read and change settings of the active profile",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Usage:   "Show every setting with the layer it comes from",
+						Action:  HandleConfigList,
+					},
+					{
+						Name:      "get",
+						ArgsUsage: "<key>",
+						Action:    HandleConfigGet,
+					},
+					{
+						Name:      "set",
+						ArgsUsage: "<key> <value>",
+						Action:    HandleConfigSet,
+					},
+					{
+						Name:   "edit",
+						Usage:  "Open the config file in $EDITOR",
+						Action: HandleConfigEdit,
+					},
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "Inspect the local cache of projects and todos",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "status",
+						Usage:  "Show what is cached and whether it is still fresh",
+						Action: HandleCacheStatus,
+					},
+					{
+						Name:   "clear",
+						Usage:  "Remove every cached response of the active profile",
+						Action: HandleCacheClear,
+					},
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "Send the changes made while offline",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "dry-run",
+						Aliases: []string{"n"},
+						Usage:   "List the queued changes without sending them",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Send changes even if the todo changed on the server since",
+					},
+					&cli.IntSliceFlag{
+						Name:  "drop",
+						Usage: "Remove the queued changes with these Ids without sending them",
+					},
+				},
+				Action: HandleSync,
+			},
+			{
+				Name:   "whoami",
+				Usage:  "Show the active profile and logged in account",
+				Action: HandleWhoami,
+			},
+			{
+				Name:  "profile",
+				Usage: "Manage named accounts on different cli-do servers",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "endpoint",
+								Aliases: []string{"e"},
+								Usage:   "API endpoint of the cli-do server",
+							},
+							&cli.StringFlag{
+								Name:    "client-id",
+								Aliases: []string{"c"},
+								Usage:   "OAuth client ID for the server",
+							},
+						},
+						Action: HandleProfileAdd,
+					},
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Action:  HandleProfileList,
+					},
+					{
+						Name:      "use",
+						ArgsUsage: "<name>",
+						Action:    HandleProfileUse,
+					},
+					{
+						Name:      "remove",
+						Aliases:   []string{"rm"},
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "force",
+								Usage:   "Remove the profile even if queued offline changes have not been synced, dropping them",
+								Aliases: []string{"f"},
+							},
+						},
+						Action: HandleProfileRemove,
+					},
+				},
+			},
+			{
+				Name:  "agenda",
+				Usage: "Show the todos of every project, grouped by due date",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "all",
+						Aliases: []string{"a"},
+						Usage:   "Include completed todos",
+					},
+				},
+				Action: HandleAgenda,
+			},
+			{
+				Name:    "todo",
+				Aliases: []string{"t"},
+				Usage:   "Todo operations",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "all",
+								Aliases: []string{"a"},
+							},
+							&cli.BoolFlag{
+								Name:  "all-projects",
+								Usage: "List the todos of every project, grouped by due date",
+							},
+							&cli.BoolFlag{
+								Name:  "completed",
+								Usage: "Only list completed todos",
+							},
+							&cli.BoolFlag{
+								Name:  "overdue",
+								Usage: "Only list open todos past their due date",
+							},
+							&cli.TimestampFlag{
+								Name:   "due-before",
+								Usage:  "Only list todos due before this date",
+								Layout: "2006-01-02",
+							},
+							&cli.TimestampFlag{
+								Name:   "due-after",
+								Usage:  "Only list todos due after this date",
+								Layout: "2006-01-02",
+							},
+							&cli.StringFlag{
+								Name:  "grep",
+								Usage: "Only list todos whose subject or body contains this text",
+							},
+							&cli.StringFlag{
+								Name:  "sort",
+								Usage: "Order by due, ticket or subject",
+							},
+							&cli.BoolFlag{
+								Name:    "reverse",
+								Aliases: []string{"r"},
+								Usage:   "Reverse the order",
+							},
+						},
+						Action: HandleTodosList,
+					},
+					{
+						Name:      "get",
+						ArgsUsage: "<ticket>",
+						Aliases:   []string{"g"},
+						Action:    HandleGetTodo,
+					},
+					{
+						Name:    "edit",
+						Aliases: []string{"e"},
+						Action:  HandleEditTodo,
+					},
+					{
+						Name:    "new",
+						Aliases: []string{"n"},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "subject",
+								Aliases: []string{"s"},
+								Usage:   "Subject of the todo",
+							},
+							&cli.StringFlag{
+								Name:    "body",
+								Aliases: []string{"b"},
+								Usage:   "Body of the todo",
+							},
+							&cli.TimestampFlag{
+								Name:    "due-date",
+								Aliases: []string{"d"},
+								Usage:   "Due date of the todo",
+								Layout:  "2006-01-02",
+							},
+							&cli.BoolFlag{
+								Name:    "edit",
+								Aliases: []string{"e"},
+								Usage:   "Compose the todo in $VISUAL or $EDITOR, as is done when --subject is omitted",
+							},
+						},
+						Action: HandleCreateTodo,
+					},
+					{
+						Name:    "archive",
+						Aliases: []string{"a"},
+						Action:  HandleArchiveTodo,
+					},
+					{
+						Name:    "complete",
+						Aliases: []string{"co"},
+						Action:  HandleCompleteTodo,
+					},
+					{
+						Name:      "search",
+						Aliases:   []string{"s"},
+						Usage:     "Find todos in every project matching a query such as 'due<7d AND NOT completed'",
+						ArgsUsage: "<query|@name>",
+						Action:    HandleTodoSearch,
+					},
+				},
+			},
+			{
+				Name:  "query",
+				Usage: "Manage saved todo search queries",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "save",
+						Usage:     "Save a query to use as @name",
+						ArgsUsage: "<name> <query>",
+						Action:    HandleQuerySave,
+					},
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Action:  HandleQueryList,
+					},
+					{
+						Name:      "remove",
+						Aliases:   []string{"rm"},
+						ArgsUsage: "<name>",
+						Action:    HandleQueryRemove,
+					},
+				},
+			},
+			{
+				Name:    "project",
+				Usage:   "Project operations",
+				Aliases: []string{"p"},
+				Subcommands: []*cli.Command{
+					{
+						Name:      "init",
+						Aliases:   []string{"i"},
+						ArgsUsage: "<project>",
+						Action: func(ctx *cli.Context) error {
+							return HandleInitProjectDirectory(ctx)
+						},
+					},
+					{
+						Name:    "new",
+						Aliases: []string{"n"},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "name",
+								Aliases: []string{"n"},
+								Usage:   "Name of the project",
+							},
+							&cli.StringFlag{
+								Name:    "description",
+								Aliases: []string{"d"},
+								Usage:   "Description of the project",
+							},
+							&cli.StringFlag{
+								Name:    "key",
+								Aliases: []string{"k"},
+								Usage:   "Short code used in todo references such as KEY-42, derived from the name when omitted",
+							},
+						},
+						Action: HandleProjectNew,
+					},
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Action:  HandleProjectList,
+					},
+					{
+						Name:      "archive",
+						Aliases:   []string{"a"},
+						ArgsUsage: "<project>",
+						Action:    HandleProjectArchive,
+					},
+				},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			fmt.Fprintln(ctx.App.Writer, "Hello, cli-do! Run 'cli-do help' for more information.")
+			return nil
+		},
+	}
+
+	setUsageErrorHandler(app.Commands)
+
+	return app
+}
+
+func setUsageErrorHandler(cmds []*cli.Command) {
+	for _, command := range cmds {
+		command.OnUsageError = HandleUsageError
+		setUsageErrorHandler(command.Subcommands)
+	}
+}
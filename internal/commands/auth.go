@@ -0,0 +1,643 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+func HandleLogin(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	config, err := GetConfig(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	var email = ctx.String("email")
+	var reader = bufio.NewReader(ctx.App.Reader)
+
+	if ctx.Bool("device") {
+		return LoginWithDevice(ctx.Context, ctx.App.Writer, profile, config)
+	}
+
+	if ctx.Bool("token-stdin") {
+		token, err := readLine(reader)
+
+		if err != nil || token == "" {
+			return NewUsageError("Unable to read a token from stdin.")
+		}
+
+		return LoginWithToken(ctx.Context, ctx.App.Writer, profile, config, email, token)
+	}
+
+	if ctx.Bool("password-stdin") {
+		if email == "" {
+			return NewUsageError("--password-stdin requires --email.")
+		}
+
+		password, err := readLine(reader)
+
+		if err != nil || password == "" {
+			return NewUsageError("Unable to read a password from stdin.")
+		}
+
+		return LoginUser(ctx.Context, ctx.App.Writer, profile, config, email, password)
+	}
+
+	if !ctx.Bool("force") {
+		loggedIn, err := ensureSession(ctx.Context, ctx.App.Writer, profile, config)
+
+		if err != nil {
+			return err
+		}
+
+		if loggedIn {
+			fmt.Fprintln(ctx.App.Writer, "You are already logged in! Use --force to log in again.")
+			return nil
+		}
+	}
+
+	stdin, ok := ctx.App.Reader.(*os.File)
+
+	if !ok || !term.IsTerminal(int(stdin.Fd())) {
+		return NewUsageError("stdin is not a terminal. Use --email with --password-stdin, or --token-stdin.")
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Login to cli-do")
+
+	if email == "" {
+		fmt.Fprint(ctx.App.Writer, "Email: ")
+
+		email, err = readLine(reader)
+
+		if err != nil || email == "" {
+			return NewUsageError("Unable to read email.")
+		}
+	}
+
+	fmt.Fprint(ctx.App.Writer, "Password: ")
+	password, err := term.ReadPassword(int(stdin.Fd()))
+	fmt.Fprintln(ctx.App.Writer)
+
+	if err != nil {
+		return NewUsageError("Unable to read password: %s", err)
+	}
+
+	return LoginUser(ctx.Context, ctx.App.Writer, profile, config, email, string(password))
+}
+
+func LoginUser(ctx context.Context, w io.Writer, profile string, config clido.Config, email string, password string) error {
+	fmt.Fprintln(w, "Logging in...")
+
+	var api = clido.NewClient(config)
+
+	err := api.Login(ctx, clido.Login{
+		Email:    email,
+		Password: password,
+		ClientId: config.ClientId,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = forgetPreviousAccount(profile, config, api.Auth())
+
+	if err != nil {
+		return err
+	}
+
+	err = saveLogin(profile, config, api.Auth())
+
+	if err != nil {
+		return fmt.Errorf("logged in but unable to save credentials: %w", err)
+	}
+
+	fmt.Fprintln(w, "Welcome to cli-do!")
+
+	return nil
+}
+
+// LoginWithDevice signs in through the OAuth device authorization flow, for
+// accounts that authenticate with SSO in a browser rather than a password.
+func LoginWithDevice(ctx context.Context, w io.Writer, profile string, config clido.Config) error {
+	var api = clido.NewClient(config)
+
+	authorization, err := api.RequestDeviceCode(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "To log in, open %s and enter the code %s\n", authorization.VerificationUri, authorization.UserCode)
+
+	if authorization.VerificationUriComplete != "" {
+		fmt.Fprintf(w, "or open %s\n", authorization.VerificationUriComplete)
+	}
+
+	fmt.Fprintln(w, "Waiting for approval...")
+
+	err = api.PollDeviceToken(ctx, authorization)
+
+	if errors.Is(err, clido.ErrCodeExpired) {
+		return fmt.Errorf("%w, run 'cli-do login --device' to try again", err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = forgetPreviousAccount(profile, config, api.Auth())
+
+	if err != nil {
+		return err
+	}
+
+	err = saveLogin(profile, config, api.Auth())
+
+	if err != nil {
+		return fmt.Errorf("logged in but unable to save credentials: %w", err)
+	}
+
+	fmt.Fprintln(w, "Welcome to cli-do!")
+
+	return nil
+}
+
+// LoginWithToken saves a personal access token after checking the server
+// accepts it. Such tokens do not expire and have no refresh token.
+func LoginWithToken(ctx context.Context, w io.Writer, profile string, config clido.Config, email string, token string) error {
+	var auth = TokenAuth(email, token)
+	var api = clido.NewClient(config, clido.WithAuth(auth))
+
+	_, err := api.GetProjects(ctx)
+
+	if err != nil {
+		var apiError *clido.ApiError
+		if errors.As(err, &apiError) && errors.Is(err, clido.ErrUnauthorized) {
+			apiError.Message = "Invalid or revoked access token."
+		}
+
+		return err
+	}
+
+	err = forgetPreviousAccount(profile, config, auth)
+
+	if err != nil {
+		return err
+	}
+
+	err = saveLogin(profile, config, auth)
+
+	if err != nil {
+		return fmt.Errorf("token accepted but unable to save credentials: %w", err)
+	}
+
+	fmt.Fprintln(w, "Welcome to cli-do!")
+
+	return nil
+}
+
+// forgetPreviousAccount forgets the cache kept for the account the profile
+// was logged in to when auth belongs to another one, or to another endpoint.
+// It is refused while changes queued for that account have not been synced.
+func forgetPreviousAccount(profile string, config clido.Config, auth clido.Auth) error {
+	changed, err := accountChanged(profile, config, auth)
+
+	if err != nil || !changed {
+		return err
+	}
+
+	queued, err := queuedChanges(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if queued > 0 {
+		return NewUsageError("%d queued changes of the previous account have not been synced. Run 'cli-do sync' first, or 'cli-do logout --force' to drop them.", queued)
+	}
+
+	_, err = forgetAccountData(profile)
+
+	return err
+}
+
+// saveLogin saves the credentials of a new login and the endpoint they are
+// for.
+func saveLogin(profile string, config clido.Config, auth clido.Auth) error {
+	if err := SaveAuth(profile, auth); err != nil {
+		return err
+	}
+
+	return writeLoginEndpoint(profile, config.Endpoint)
+}
+
+// accountChanged reports whether auth belongs to another account than the
+// profile was logged in to. Accounts are only told apart when both emails are
+// known, as token logins and some servers do not give one.
+func accountChanged(profile string, config clido.Config, auth clido.Auth) (bool, error) {
+	endpoint, err := readLoginEndpoint(profile)
+
+	if err != nil {
+		return false, err
+	}
+
+	if endpoint != "" && strings.TrimSuffix(endpoint, "/") != strings.TrimSuffix(config.Endpoint, "/") {
+		return true, nil
+	}
+
+	// Unreadable credentials are as good as none, and logging in replaces them.
+	previous, err := GetAuth(profile)
+
+	if err != nil {
+		return false, nil
+	}
+
+	return previous.Email != "" && auth.Email != "" && previous.Email != auth.Email, nil
+}
+
+func loginEndpointPath(profile string) (string, error) {
+	dir, err := ProfileDir(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "login.json"), nil
+}
+
+type loginRecord struct {
+	Endpoint string `json:"endpoint"`
+}
+
+// readLoginEndpoint returns the endpoint the profile last logged in to, or ""
+// when it is not known.
+func readLoginEndpoint(profile string) (string, error) {
+	path, err := loginEndpointPath(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	byteValue, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	var record loginRecord
+
+	if err := json.Unmarshal(byteValue, &record); err != nil {
+		return "", nil
+	}
+
+	return record.Endpoint, nil
+}
+
+func writeLoginEndpoint(profile string, endpoint string) error {
+	path, err := loginEndpointPath(profile)
+
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(loginRecord{Endpoint: endpoint})
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, append(bytes, '\n'), 0600)
+}
+
+func TokenAuth(email string, token string) clido.Auth {
+	return clido.Auth{
+		Email:       email,
+		AccessToken: token,
+		TokenType:   "Bearer",
+	}
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ensureSession reports whether the profile has usable credentials, refreshing
+// an expired token when possible.
+func ensureSession(ctx context.Context, w io.Writer, profile string, config clido.Config) (bool, error) {
+	auth, err := GetAuth(profile)
+
+	if errors.Is(err, ErrNotLoggedIn) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if !auth.IsExpired() {
+		return true, nil
+	}
+
+	if auth.RefreshToken == "" {
+		fmt.Fprintln(w, "Your session has expired.")
+		return false, nil
+	}
+
+	err = newClient(profile, config, auth).RefreshToken(ctx)
+
+	if errors.Is(err, clido.ErrUnauthorized) {
+		fmt.Fprintln(w, "Your session has expired.")
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+type AuthStatus struct {
+	Profile   string     `json:"profile" yaml:"profile"`
+	Endpoint  string     `json:"endpoint" yaml:"endpoint"`
+	Email     string     `json:"email" yaml:"email"`
+	Source    string     `json:"source" yaml:"source"`
+	ExpiresAt *time.Time `json:"expires_at" yaml:"expires_at"`
+	Expired   bool       `json:"expired" yaml:"expired"`
+	Refresh   bool       `json:"refreshable" yaml:"refreshable"`
+}
+
+func HandleAuthStatus(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	config, _, err := LoadConfig(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	auth, err := GetAuth(profile)
+
+	if err != nil {
+		return err
+	}
+
+	var status = AuthStatus{
+		Profile:  profile,
+		Endpoint: config.Endpoint,
+		Email:    auth.Email,
+		Source:   "credential store",
+		Expired:  auth.IsExpired(),
+		Refresh:  auth.RefreshToken != "",
+	}
+
+	if os.Getenv("CLI_DO_TOKEN") != "" {
+		status.Source = "CLI_DO_TOKEN"
+	}
+
+	if auth.CreatedAt != 0 && auth.ExpiresIn != 0 {
+		var expiresAt = auth.ExpiresAt()
+		status.ExpiresAt = &expiresAt
+	}
+
+	return Output{
+		Value:   status,
+		Items:   []interface{}{status},
+		Columns: []string{"profile", "endpoint", "email", "source", "expires_at", "expired", "refreshable"},
+		Record: func(item interface{}) []string {
+			var status = item.(AuthStatus)
+			var expiresAt string
+
+			if status.ExpiresAt != nil {
+				expiresAt = status.ExpiresAt.Format(time.RFC3339)
+			}
+
+			return []string{
+				status.Profile,
+				status.Endpoint,
+				status.Email,
+				status.Source,
+				expiresAt,
+				strconv.FormatBool(status.Expired),
+				strconv.FormatBool(status.Refresh),
+			}
+		},
+		Table: func(w io.Writer) {
+			PrintAuthStatus(w, status)
+		},
+	}.Render(ctx)
+}
+
+func PrintAuthStatus(w io.Writer, status AuthStatus) {
+	var email = status.Email
+
+	if email == "" {
+		email = "unknown"
+	}
+
+	fmt.Fprintln(w, "Profile:", status.Profile)
+	fmt.Fprintln(w, "Endpoint:", status.Endpoint)
+	fmt.Fprintln(w, "Logged in as:", email)
+	fmt.Fprintln(w, "Credentials:", status.Source)
+
+	switch {
+	case status.ExpiresAt == nil:
+		fmt.Fprintln(w, "Token expires: never")
+	case status.Expired && status.Refresh:
+		fmt.Fprintf(w, "Token expired: %s (will be refreshed on the next request)\n", status.ExpiresAt.Local().Format(time.RFC1123))
+	case status.Expired:
+		fmt.Fprintf(w, "Token expired: %s (run 'cli-do login')\n", status.ExpiresAt.Local().Format(time.RFC1123))
+	default:
+		fmt.Fprintf(w, "Token expires: %s (in %s)\n", status.ExpiresAt.Local().Format(time.RFC1123), time.Until(*status.ExpiresAt).Round(time.Second))
+	}
+}
+
+// HandleAuthToken prints the bearer token, refreshed first if it has expired,
+// so scripts can call the API directly.
+func HandleAuthToken(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	config, err := GetConfig(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	auth, err := GetAuth(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if auth.IsExpired() {
+		var client = newClient(profile, config, auth)
+
+		if err := client.RefreshToken(ctx.Context); err != nil {
+			return err
+		}
+
+		auth = client.Auth()
+	}
+
+	fmt.Fprintln(ctx.App.Writer, auth.AccessToken)
+
+	return nil
+}
+
+func HandleLogout(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv("CLI_DO_TOKEN") != "" {
+		return NewUsageError("Credentials come from CLI_DO_TOKEN. Unset it to log out.")
+	}
+
+	config, err := GetConfig(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	auth, err := GetAuth(profile)
+
+	if errors.Is(err, ErrNotLoggedIn) {
+		fmt.Fprintln(ctx.App.Writer, "You are not logged in.")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := requireSyncedQueue(ctx, profile); err != nil {
+		return err
+	}
+
+	var revokeErr = clido.NewClient(config, clido.WithAuth(auth)).RevokeToken(ctx.Context)
+
+	if err := DeleteAuth(profile); err != nil {
+		return err
+	}
+
+	dropped, err := forgetAccountData(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if dropped > 0 {
+		fmt.Fprintf(ctx.App.Writer, "Dropped %d queued changes that were not synced.\n", dropped)
+	}
+
+	if revokeErr != nil {
+		return fmt.Errorf("removed local credentials but the server did not revoke the token: %w", revokeErr)
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Logged out.")
+
+	return nil
+}
+
+func newClient(profile string, config clido.Config, auth clido.Auth) *clido.Client {
+	var saveAuth = func(auth clido.Auth) error {
+		return SaveAuth(profile, auth)
+	}
+
+	return clido.NewClient(config, clido.WithAuth(auth), clido.WithTokenRefreshed(saveAuth))
+}
+
+// NewApiFromContext builds a client from the active profile's config and
+// credentials, answering reads from the cache where it can. Refreshed tokens
+// are written back to the credential store.
+func NewApiFromContext(ctx *cli.Context) (clido.Api, error) {
+	api, err := newCachedApiFromContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return api, nil
+}
+
+func newCachedApiFromContext(ctx *cli.Context) (*CachedApi, error) {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := GetConfig(ctx, profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := GetAuth(profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := CacheDir(profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queue, err := QueueFile(profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var api = NewCachedApi(newClient(profile, config, auth), dir, queue, config.CacheTTL.Duration, ctx.Bool("offline"))
+
+	if ctx.App.Metadata == nil {
+		ctx.App.Metadata = map[string]interface{}{}
+	}
+
+	ctx.App.Metadata[cacheMetadataKey] = api
+
+	return api, nil
+}
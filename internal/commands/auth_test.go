@@ -0,0 +1,207 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func TestHandleAuthStatus(t *testing.T) {
+	setup(t)
+
+	out, err := run(t, "-o", "json", "auth", "status")
+
+	if err != nil {
+		t.Fatalf("auth status: %v", err)
+	}
+
+	var status AuthStatus
+
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+
+	if status.Profile != DefaultProfile || status.Email != "reed@example.com" || status.Expired || status.ExpiresAt == nil {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if until := time.Until(*status.ExpiresAt); until <= 0 || until > time.Hour {
+		t.Fatalf("unexpected expiry %v", status.ExpiresAt)
+	}
+}
+
+func TestHandleAuthToken(t *testing.T) {
+	var server = setup(t)
+
+	auth, _ := GetAuth(DefaultProfile)
+	auth.CreatedAt = int(time.Now().Add(-2 * time.Hour).Unix())
+
+	if err := SaveAuth(DefaultProfile, auth); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, "auth", "token")
+
+	if err != nil {
+		t.Fatalf("auth token: %v", err)
+	}
+
+	var token = strings.TrimSpace(out)
+
+	if token == auth.AccessToken || server.Revoked(token) {
+		t.Fatalf("expected a refreshed token, got %q", token)
+	}
+}
+
+func TestHandleLoginExpiredSession(t *testing.T) {
+	setup(t)
+
+	auth, _ := GetAuth(DefaultProfile)
+	auth.CreatedAt = int(time.Now().Add(-2 * time.Hour).Unix())
+	auth.RefreshToken = ""
+
+	if err := SaveAuth(DefaultProfile, auth); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "login"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want a prompt for new credentials", err)
+	}
+}
+
+func TestHandleLogout(t *testing.T) {
+	var server = setup(t)
+
+	auth, _ := GetAuth(DefaultProfile)
+
+	if _, err := run(t, "logout"); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+
+	if !server.Revoked(auth.AccessToken) || !server.Revoked(auth.RefreshToken) {
+		t.Fatal("expected tokens to be revoked")
+	}
+
+	if _, err := GetAuth(DefaultProfile); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("got %v, want ErrNotLoggedIn", err)
+	}
+
+	if _, err := run(t, "auth", "status"); ExitCode(err) != ExitAuth {
+		t.Fatalf("got %v, want an auth error", err)
+	}
+
+	if _, err := run(t, "logout"); err != nil {
+		t.Fatalf("logout twice: %v", err)
+	}
+}
+
+func TestAccountChangeForgetsCacheAndQueue(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+	server.AddUser("reed@example.com", "hunter2")
+	server.AddUser("ci@example.com", "hunter2")
+
+	var cacheDir, _ = CacheDir(DefaultProfile)
+	var queuePath, _ = QueueFile(DefaultProfile)
+	var useAccount = func() {
+		t.Helper()
+
+		if _, err := run(t, "-p", project.Id, "todo", "list"); err != nil {
+			t.Fatalf("todo list: %v", err)
+		}
+
+		if _, err := run(t, "--offline", "-p", project.Id, "todo", "complete", "1"); err != nil {
+			t.Fatalf("todo complete: %v", err)
+		}
+	}
+	var forgotten = func() bool {
+		var _, err = os.Stat(cacheDir)
+		queue, _ := readQueue(queuePath)
+
+		return errors.Is(err, os.ErrNotExist) && len(queue.Changes) == 0
+	}
+
+	var cached = func() bool {
+		var _, err = os.Stat(cacheDir)
+
+		return err == nil
+	}
+	var sync = func() {
+		t.Helper()
+
+		if _, err := run(t, "sync"); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+
+	useAccount()
+
+	if _, err := runWithInput(t, "hunter2\n", "login", "--email", "reed@example.com", "--password-stdin"); err != nil || forgotten() {
+		t.Fatalf("expected logging in to the same account to keep the cache and queue, got %v", err)
+	}
+
+	if _, err := runWithInput(t, "hunter2\n", "login", "--email", "ci@example.com", "--password-stdin"); ExitCode(err) != ExitUsage || forgotten() {
+		t.Fatalf("expected logging in to another account with queued changes to be refused, got %v", err)
+	}
+
+	sync()
+
+	if _, err := runWithInput(t, "hunter2\n", "login", "--email", "ci@example.com", "--password-stdin"); err != nil || cached() {
+		t.Fatalf("expected logging in to another account to forget the cache, got %v", err)
+	}
+
+	if auth, _ := GetAuth(DefaultProfile); auth.Email != "ci@example.com" {
+		t.Fatalf("expected ci@example.com to be logged in, got %q", auth.Email)
+	}
+
+	useAccount()
+
+	var token = server.Authorize("ci@example.com").AccessToken
+
+	if _, err := runWithInput(t, token+"\n", "login", "--token-stdin"); err != nil || forgotten() {
+		t.Fatalf("expected a token login without an email to keep the cache and queue, got %v", err)
+	}
+
+	if _, err := run(t, "logout"); ExitCode(err) != ExitUsage || forgotten() {
+		t.Fatalf("expected logging out with queued changes to be refused, got %v", err)
+	}
+
+	if _, err := run(t, "logout", "--force"); err != nil || !forgotten() {
+		t.Fatalf("expected logging out with --force to forget the cache and queue, got %v", err)
+	}
+
+	if _, err := runWithInput(t, "hunter2\n", "login", "--email", "ci@example.com", "--password-stdin"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	var other = clidotest.NewServer()
+	defer other.Close()
+	other.AddUser("ci@example.com", "hunter2")
+
+	useAccount()
+	sync()
+
+	if _, err := runWithInput(t, "hunter2\n", "--endpoint", other.URL, "login", "--email", "ci@example.com", "--password-stdin"); err != nil || cached() {
+		t.Fatalf("expected logging in to another endpoint to forget the cache, got %v", err)
+	}
+}
+
+func TestHandleLogoutServerError(t *testing.T) {
+	var server = setup(t)
+	server.FailNext(http.StatusInternalServerError)
+
+	if _, err := run(t, "logout"); ExitCode(err) != ExitServer {
+		t.Fatalf("got %v, want a server error", err)
+	}
+
+	if _, err := GetAuth(DefaultProfile); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("expected local credentials to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,662 @@
+package commands
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// ErrOffline reports that a command needed the server while --offline was
+// set and the cache could not answer instead.
+var ErrOffline = errors.New("offline")
+
+const cacheMetadataKey = "cache"
+
+// CacheDir is where cached server responses for profile are kept, under
+// $XDG_CACHE_HOME or ~/.cache.
+func CacheDir(profile string) (string, error) {
+	var dir = os.Getenv("XDG_CACHE_HOME")
+
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+
+		if err != nil {
+			return "", err
+		}
+
+		dir = filepath.Join(homeDir, ".cache")
+	}
+
+	if profile == "" {
+		profile = DefaultProfile
+	}
+
+	return filepath.Join(dir, "cli-do", profile), nil
+}
+
+// cacheEntry is a cached read. ETag is that of a cached todo, which is not
+// part of its JSON.
+type cacheEntry struct {
+	Key       string          `json:"key"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	ETag      string          `json:"etag,omitempty"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// CachedApi answers project and todo reads from an on-disk cache while it is
+// younger than ttl, when offline is set, or when the server cannot be
+// reached. Changes go to the server and drop the cached reads they affect;
+// while offline they are written to the queue for 'cli-do sync' instead.
+type CachedApi struct {
+	clido.Api
+	dir     string
+	queue   string
+	ttl     time.Duration
+	offline bool
+
+	mu       sync.Mutex
+	served   bool
+	fallback bool
+	oldest   time.Time
+}
+
+func NewCachedApi(api clido.Api, dir string, queue string, ttl time.Duration, offline bool) *CachedApi {
+	return &CachedApi{Api: api, dir: dir, queue: queue, ttl: ttl, offline: offline}
+}
+
+func (api *CachedApi) GetProjects(ctx context.Context) (clido.Projects, error) {
+	var projects clido.Projects
+
+	err := api.read("projects", "projects.json", &projects, func() (err error) {
+		projects, err = api.Api.GetProjects(ctx)
+		return err
+	})
+
+	return projects, err
+}
+
+// GetProject looks the project up in the cached project list before asking
+// the server.
+func (api *CachedApi) GetProject(ctx context.Context, projectId string) (clido.Project, error) {
+	var projects clido.Projects
+
+	if api.lookup("projects.json", &projects, api.offline) {
+		for _, project := range projects.Projects {
+			if project.Id == projectId {
+				return project, nil
+			}
+		}
+	}
+
+	if api.offline {
+		return clido.Project{}, fmt.Errorf("%w: project %s is not cached", ErrOffline, projectId)
+	}
+
+	return api.Api.GetProject(ctx, projectId)
+}
+
+func (api *CachedApi) ListTodos(ctx context.Context, projectId string, all bool) (clido.Todos, error) {
+	return api.QueryTodos(ctx, projectId, clido.TodoQuery{All: all})
+}
+
+func (api *CachedApi) QueryTodos(ctx context.Context, projectId string, query clido.TodoQuery) (clido.Todos, error) {
+	var todos clido.Todos
+	var values = query.Values().Encode()
+	var sum = sha256.Sum256([]byte(values))
+	var path = filepath.Join(projectCachePath(projectId), "todos-"+hex.EncodeToString(sum[:8])+".json")
+	var key = fmt.Sprintf("todos of %s", projectId)
+
+	if values != "" {
+		key += "?" + values
+	}
+
+	err := api.read(key, path, &todos, func() (err error) {
+		todos, err = api.Api.QueryTodos(ctx, projectId, query)
+		return err
+	})
+
+	return todos, err
+}
+
+func (api *CachedApi) GetTodo(ctx context.Context, projectId string, ticket string) (clido.Todo, error) {
+	var todo clido.Todo
+
+	if isProvisional(projectId, ticket) {
+		queue, err := readQueue(api.queue)
+
+		if err != nil {
+			return todo, err
+		}
+
+		if queued := api.queuedTodo(queue, projectId, ticket, nil); queued != nil {
+			return *queued, nil
+		}
+
+		return todo, NewNotFoundError("No todo %s is queued in %s.", ticket, projectId)
+	}
+	var path = todoCachePath(projectId, ticket)
+
+	err := api.read(fmt.Sprintf("todo %s of %s", ticket, projectId), path, &todo, func() (err error) {
+		todo, err = api.Api.GetTodo(ctx, projectId, ticket)
+		return err
+	})
+
+	return todo, err
+}
+
+// GetFreshTodo is GetTodo ignoring the TTL, for edits that must start from
+// the server's current copy. The cache is only used offline or when the
+// server cannot be reached.
+func (api *CachedApi) GetFreshTodo(ctx context.Context, projectId string, ticket string) (clido.Todo, error) {
+	if !api.useServer(projectId, ticket) {
+		return api.GetTodo(ctx, projectId, ticket)
+	}
+
+	var path = todoCachePath(projectId, ticket)
+	todo, err := api.Api.GetTodo(ctx, projectId, ticket)
+
+	if err != nil {
+		if isNetworkError(err) && api.lookup(path, &todo, true) {
+			return todo, nil
+		}
+
+		return todo, err
+	}
+
+	api.store(fmt.Sprintf("todo %s of %s", ticket, projectId), path, &todo)
+
+	return todo, nil
+}
+
+func (api *CachedApi) CreateProject(ctx context.Context, createProject clido.CreateProject) (clido.Project, error) {
+	if !api.offline {
+		project, err := api.Api.CreateProject(ctx, createProject)
+		api.invalidate("projects.json")
+
+		if !isUnreachable(err) {
+			return project, notQueued(err)
+		}
+	}
+
+	return clido.Project{}, api.enqueue(QueuedChange{Kind: ChangeCreateProject, CreateProject: &createProject})
+}
+
+func (api *CachedApi) ArchiveProject(ctx context.Context, projectId string) error {
+	if api.offline || isProvisional(projectId, "") {
+		return errOfflineChange
+	}
+
+	defer api.invalidate("projects.json", projectCachePath(projectId))
+
+	return api.Api.ArchiveProject(ctx, projectId)
+}
+
+func (api *CachedApi) CreateTodo(ctx context.Context, projectId string, createTodo clido.CreateTodo) (clido.Todo, error) {
+	if api.useServer(projectId, "") {
+		todo, err := api.Api.CreateTodo(ctx, projectId, createTodo)
+		api.invalidate(projectCachePath(projectId))
+
+		if !isUnreachable(err) {
+			return todo, notQueued(err)
+		}
+	}
+
+	return clido.Todo{}, api.enqueue(QueuedChange{Kind: ChangeCreateTodo, ProjectId: projectId, CreateTodo: &createTodo})
+}
+
+func (api *CachedApi) UpdateTodo(ctx context.Context, projectId string, ticket string, updateTodo clido.UpdateTodo) error {
+	if api.useServer(projectId, ticket) {
+		var err = api.Api.UpdateTodo(ctx, projectId, ticket, updateTodo)
+		api.invalidate(projectCachePath(projectId))
+
+		if !isUnreachable(err) {
+			return notQueued(err)
+		}
+	}
+
+	return api.enqueue(QueuedChange{Kind: ChangeUpdateTodo, ProjectId: projectId, Ticket: ticket, UpdateTodo: &updateTodo})
+}
+
+func (api *CachedApi) ArchiveTodo(ctx context.Context, projectId string, ticket string) error {
+	if api.useServer(projectId, ticket) {
+		var err = api.Api.ArchiveTodo(ctx, projectId, ticket)
+		api.invalidate(projectCachePath(projectId))
+
+		if !isUnreachable(err) {
+			return notQueued(err)
+		}
+	}
+
+	return api.enqueue(QueuedChange{Kind: ChangeArchiveTodo, ProjectId: projectId, Ticket: ticket})
+}
+
+func (api *CachedApi) CompleteTodo(ctx context.Context, projectId string, ticket string) error {
+	if api.useServer(projectId, ticket) {
+		var err = api.Api.CompleteTodo(ctx, projectId, ticket)
+		api.invalidate(projectCachePath(projectId))
+
+		if !isUnreachable(err) {
+			return notQueued(err)
+		}
+	}
+
+	return api.enqueue(QueuedChange{Kind: ChangeCompleteTodo, ProjectId: projectId, Ticket: ticket})
+}
+
+// notQueued explains a change that failed on the network after it may have
+// reached the server, such as by timing out. Queuing it could apply it twice,
+// so it is reported instead.
+func notQueued(err error) error {
+	if !isNetworkError(err) {
+		return err
+	}
+
+	return fmt.Errorf("%w\nThe request may have reached the server, so it was not queued. Check whether the change was made before trying again.", err)
+}
+
+// useServer reports whether a change can be sent now: not with --offline,
+// and not to a project or todo that only exists in the queue.
+func (api *CachedApi) useServer(projectId string, ticket string) bool {
+	return !api.offline && !isProvisional(projectId, ticket)
+}
+
+var errOfflineChange = fmt.Errorf("%w: projects can only be archived with the server", ErrOffline)
+
+// Stale reports whether anything was answered from the cache, when the oldest
+// of those answers was fetched, and whether the server was skipped because
+// of --offline or a network failure rather than a fresh cache.
+func (api *CachedApi) Stale() (bool, time.Time, bool) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	return api.served, api.oldest, api.fallback
+}
+
+// read fills value from the cache entry at path when it can be used, and
+// otherwise calls fetch, which sets value, and caches the result.
+func (api *CachedApi) read(key string, path string, value interface{}, fetch func() error) error {
+	if api.lookup(path, value, api.offline) {
+		return nil
+	}
+
+	if api.offline {
+		return fmt.Errorf("%w: %s have not been cached yet", ErrOffline, key)
+	}
+
+	err := fetch()
+
+	if err != nil {
+		if isNetworkError(err) && api.lookup(path, value, true) {
+			return nil
+		}
+
+		return err
+	}
+
+	api.store(key, path, value)
+
+	return nil
+}
+
+// lookup decodes the entry at path into value when it is younger than the
+// TTL, or of any age with fallback.
+func (api *CachedApi) lookup(path string, value interface{}, fallback bool) bool {
+	entry, ok := api.readEntry(path)
+
+	if !ok {
+		return false
+	}
+
+	if !fallback && time.Since(entry.FetchedAt) >= api.ttl {
+		return false
+	}
+
+	if err := json.Unmarshal(entry.Value, value); err != nil {
+		return false
+	}
+
+	if todo, ok := value.(*clido.Todo); ok {
+		todo.ETag = entry.ETag
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if !api.served || entry.FetchedAt.Before(api.oldest) {
+		api.oldest = entry.FetchedAt
+	}
+
+	api.served = true
+	api.fallback = api.fallback || fallback
+
+	return true
+}
+
+func (api *CachedApi) readEntry(path string) (cacheEntry, bool) {
+	var entry cacheEntry
+	byteValue, err := os.ReadFile(filepath.Join(api.dir, path))
+
+	if err != nil {
+		return entry, false
+	}
+
+	if err := json.Unmarshal(byteValue, &entry); err != nil {
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// cachedTodo finds the cached copy of a todo, of any age, from GetTodo or
+// from one of the cached lists of its project.
+func (api *CachedApi) cachedTodo(projectId string, ticket string) *clido.Todo {
+	var dir = projectCachePath(projectId)
+	var paths, _ = filepath.Glob(filepath.Join(api.dir, dir, "todos-*.json"))
+
+	if entry, ok := api.readEntry(todoCachePath(projectId, ticket)); ok {
+		var todo clido.Todo
+
+		if json.Unmarshal(entry.Value, &todo) == nil {
+			todo.ETag = entry.ETag
+			return &todo
+		}
+	}
+
+	for _, path := range paths {
+		entry, ok := api.readEntry(filepath.Join(dir, filepath.Base(path)))
+
+		if !ok {
+			continue
+		}
+
+		var todos clido.Todos
+
+		if json.Unmarshal(entry.Value, &todos) != nil {
+			continue
+		}
+
+		for _, todo := range todos.Todos {
+			if strconv.Itoa(todo.Ticket) == ticket {
+				return &todo
+			}
+		}
+	}
+
+	return nil
+}
+
+// store writes value to path through a temporary file, so concurrent
+// commands never read half an entry. Failing to cache is not an error.
+func (api *CachedApi) store(key string, path string, value interface{}) {
+	bytes, err := json.Marshal(value)
+
+	if err != nil {
+		return
+	}
+
+	var entry = cacheEntry{Key: key, FetchedAt: time.Now(), Value: bytes}
+
+	if todo, ok := value.(*clido.Todo); ok {
+		entry.ETag = todo.ETag
+	}
+
+	bytes, err = json.Marshal(entry)
+
+	if err != nil {
+		return
+	}
+
+	path = filepath.Join(api.dir, path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+
+	if err != nil {
+		return
+	}
+
+	_, err = file.Write(bytes)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+}
+
+func (api *CachedApi) invalidate(paths ...string) {
+	for _, path := range paths {
+		_ = os.RemoveAll(filepath.Join(api.dir, path))
+	}
+}
+
+func todoCachePath(projectId string, ticket string) string {
+	return filepath.Join(projectCachePath(projectId), "todo-"+url.PathEscape(ticket)+".json")
+}
+
+func projectCachePath(projectId string) string {
+	return filepath.Join("projects", url.PathEscape(projectId))
+}
+
+// cacheNotice describes cached data a command showed, for the table output.
+func cacheNotice(ctx *cli.Context) string {
+	var api, ok = ctx.App.Metadata[cacheMetadataKey].(*CachedApi)
+
+	if !ok {
+		return ""
+	}
+
+	served, oldest, fallback := api.Stale()
+
+	if !served {
+		return ""
+	}
+
+	var age = time.Since(oldest).Round(time.Second)
+
+	if fallback {
+		return fmt.Sprintf("Offline: showing data cached %s ago.", age)
+	}
+
+	return fmt.Sprintf("Cached %s ago.", age)
+}
+
+// CacheEntry describes one cached response for 'cache status'.
+type CacheEntry struct {
+	Key       string    `json:"key" yaml:"key"`
+	FetchedAt time.Time `json:"fetched_at" yaml:"fetched_at"`
+	Fresh     bool      `json:"fresh" yaml:"fresh"`
+}
+
+func HandleCacheStatus(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	config, _, err := LoadConfig(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	dir, err := CacheDir(profile)
+
+	if err != nil {
+		return err
+	}
+
+	var entries = []CacheEntry{}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		byteValue, err := os.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		var entry cacheEntry
+
+		if err := json.Unmarshal(byteValue, &entry); err != nil {
+			return nil
+		}
+
+		entries = append(entries, CacheEntry{
+			Key:       entry.Key,
+			FetchedAt: entry.FetchedAt,
+			Fresh:     time.Since(entry.FetchedAt) < config.CacheTTL.Duration,
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	var items = make([]interface{}, 0, len(entries))
+
+	for _, entry := range entries {
+		items = append(items, entry)
+	}
+
+	return Output{
+		Value:   entries,
+		Items:   items,
+		Columns: []string{"key", "fetched_at", "fresh"},
+		Record: func(item interface{}) []string {
+			var entry = item.(CacheEntry)
+
+			return []string{entry.Key, entry.FetchedAt.Format(time.RFC3339), strconv.FormatBool(entry.Fresh)}
+		},
+		Table: func(w io.Writer) {
+			fmt.Fprintf(w, "Cache: %s (ttl %s)\n", dir, config.CacheTTL)
+
+			if len(entries) == 0 {
+				fmt.Fprintln(w, "Nothing is cached.")
+				return
+			}
+
+			var tbl = table.New("Key", "Age", "Fresh").WithWriter(w)
+
+			for _, entry := range entries {
+				tbl.AddRow(entry.Key, time.Since(entry.FetchedAt).Round(time.Second), entry.Fresh)
+			}
+
+			tbl.Print()
+		},
+	}.Render(ctx)
+}
+
+func HandleCacheClear(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	dir, err := CacheDir(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Cache cleared.")
+
+	return nil
+}
+
+// forgetAccountData removes the cached reads, project keys and queued
+// changes of profile, which all belong to the account it was logged in to.
+// It returns how many queued changes were dropped.
+func forgetAccountData(profile string) (int, error) {
+	dir, err := CacheDir(profile)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return 0, err
+	}
+
+	keysPath, err := projectKeysPath(profile)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Remove(keysPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	queuePath, err := QueueFile(profile)
+
+	if err != nil {
+		return 0, err
+	}
+
+	unlock, err := lockQueue(queuePath)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer unlock()
+
+	// An unreadable queue is removed all the same.
+	queue, _ := readQueue(queuePath)
+
+	if err := os.Remove(queuePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	return len(queue.Changes), nil
+}
@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func TestCachedReads(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	if _, err := run(t, "config", "set", "cache_ttl", "1h"); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+
+	if _, err := run(t, "project", "list"); err != nil {
+		t.Fatalf("project list: %v", err)
+	}
+
+	var requests = server.Requests()
+	out, err := run(t, "project", "list")
+
+	if err != nil {
+		t.Fatalf("project list: %v", err)
+	}
+
+	if server.Requests() != requests {
+		t.Fatal("expected a fresh cache to answer without the server")
+	}
+
+	if !strings.Contains(out, "Inbox") || !strings.Contains(out, "Cached 0s ago.") {
+		t.Fatalf("expected the cached projects and a notice in %q", out)
+	}
+
+	if _, err := run(t, "project", "new", "--name", "Errands"); err != nil {
+		t.Fatalf("project new: %v", err)
+	}
+
+	if out, _ := run(t, "project", "list"); !strings.Contains(out, "Errands") {
+		t.Fatalf("expected creating a project to drop the cached list, got %q", out)
+	}
+
+	if _, err := run(t, "-p", project.Id, "todo", "list"); err != nil {
+		t.Fatalf("todo list: %v", err)
+	}
+
+	if _, err := run(t, "-p", project.Id, "todo", "complete", "1"); err != nil {
+		t.Fatalf("todo complete: %v", err)
+	}
+
+	if out, _ := run(t, "-p", project.Id, "todo", "list"); strings.Contains(out, "Buy milk") {
+		t.Fatalf("expected completing a todo to drop the cached todos, got %q", out)
+	}
+}
+
+func TestCachedTodoKeepsETag(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	for _, format := range []string{"json", "yaml"} {
+		out, err := run(t, "-o", format, "-p", project.Id, "todo", "get", "1")
+
+		if err != nil || !strings.Contains(out, "Buy milk") || strings.Contains(out, "etag") {
+			t.Fatalf("expected -o %s to show the todo without its ETag, got %q, %v", format, out, err)
+		}
+	}
+
+	if _, err := run(t, "--offline", "-p", project.Id, "todo", "complete", "1"); err != nil {
+		t.Fatalf("todo complete: %v", err)
+	}
+
+	out, err := run(t, "-o", "json", "sync", "--dry-run")
+
+	if err != nil {
+		t.Fatalf("sync --dry-run: %v", err)
+	}
+
+	var changes []QueuedChange
+
+	if err := json.Unmarshal([]byte(out), &changes); err != nil || len(changes) != 1 || changes[0].BaseETag == "" {
+		t.Fatalf("expected the change to keep the ETag of the cached todo, got %q", out)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	if _, err := run(t, "-p", project.Id, "todo", "list"); err != nil {
+		t.Fatalf("todo list: %v", err)
+	}
+
+	var requests = server.Requests()
+	out, err := run(t, "--offline", "-p", project.Id, "todo", "list")
+
+	if err != nil {
+		t.Fatalf("offline todo list: %v", err)
+	}
+
+	if server.Requests() != requests || !strings.Contains(out, "Buy milk") || !strings.Contains(out, "Offline: showing data cached") {
+		t.Fatalf("expected the cached todos without a request, got %q", out)
+	}
+
+	for _, args := range [][]string{
+		{"--offline", "project", "list"},
+		{"--offline", "project", "archive", project.Id},
+	} {
+		if _, err := run(t, args...); ExitCode(err) != ExitNetwork {
+			t.Fatalf("%v: got exit code %d for %v, want %d", args, ExitCode(err), err, ExitNetwork)
+		}
+	}
+
+	server.Close()
+
+	if out, err := run(t, "-o", "json", "-p", project.Id, "todo", "list"); err != nil || !strings.Contains(out, "Buy milk") {
+		t.Fatalf("expected the cache to answer when the server is unreachable, got %q, %v", out, err)
+	}
+
+	if _, err := run(t, "project", "list"); ExitCode(err) != ExitNetwork {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitNetwork)
+	}
+}
+
+func TestCacheStatusAndClear(t *testing.T) {
+	var server = setup(t)
+	server.AddProject("Inbox", "")
+
+	if _, err := run(t, "project", "list"); err != nil {
+		t.Fatalf("project list: %v", err)
+	}
+
+	out, err := run(t, "-o", "json", "cache", "status")
+
+	if err != nil {
+		t.Fatalf("cache status: %v", err)
+	}
+
+	var entries []CacheEntry
+
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+
+	if len(entries) != 1 || entries[0].Key != "projects" || entries[0].Fresh {
+		t.Fatalf("expected one stale projects entry with a zero TTL, got %+v", entries)
+	}
+
+	if _, err := run(t, "cache", "clear"); err != nil {
+		t.Fatalf("cache clear: %v", err)
+	}
+
+	if out, _ := run(t, "cache", "status"); !strings.Contains(out, "Nothing is cached.") {
+		t.Fatalf("expected an empty cache, got %q", out)
+	}
+}
@@ -0,0 +1,595 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// SystemConfigFile holds settings shared by every user of the machine.
+var SystemConfigFile = "/etc/cli-do/config.json"
+
+// Configuration sources, from lowest to highest precedence.
+const (
+	ConfigSourceDefault = "default"
+	ConfigSourceSystem  = "system"
+	ConfigSourceUser    = "user"
+	ConfigSourceProfile = "profile"
+	ConfigSourceProject = "project"
+	ConfigSourceEnv     = "env"
+	ConfigSourceFlag    = "flag"
+)
+
+type ConfigKey struct {
+	Name string
+	Env  string
+	Flag string
+	// Sensitive keys decide where credentials are sent. A project file,
+	// which comes with whatever repository was cloned, cannot change them.
+	Sensitive bool
+	Get       func(config clido.Config) string
+	Set       func(config *clido.Config, value string) error
+}
+
+var ConfigKeys = []ConfigKey{
+	{
+		Name:      "endpoint",
+		Env:       "CLI_DO_ENDPOINT",
+		Flag:      "endpoint",
+		Sensitive: true,
+		Get:       func(config clido.Config) string { return config.Endpoint },
+		Set: func(config *clido.Config, value string) error {
+			config.Endpoint = strings.TrimRight(value, "/")
+			return nil
+		},
+	},
+	{
+		Name:      "client_id",
+		Env:       "CLI_DO_CLIENT_ID",
+		Flag:      "client-id",
+		Sensitive: true,
+		Get:       func(config clido.Config) string { return config.ClientId },
+		Set: func(config *clido.Config, value string) error {
+			config.ClientId = value
+			return nil
+		},
+	},
+	{
+		Name: "timeout",
+		Env:  "CLI_DO_TIMEOUT",
+		Flag: "timeout",
+		Get:  func(config clido.Config) string { return config.Timeout.String() },
+		Set: func(config *clido.Config, value string) error {
+			return parseDuration(value, &config.Timeout)
+		},
+	},
+	{
+		Name: "max_retries",
+		Env:  "CLI_DO_MAX_RETRIES",
+		Get:  func(config clido.Config) string { return strconv.Itoa(config.MaxRetries) },
+		Set: func(config *clido.Config, value string) error {
+			retries, err := strconv.Atoi(value)
+
+			if err != nil {
+				return fmt.Errorf("%q is not a whole number", value)
+			}
+
+			config.MaxRetries = retries
+
+			return nil
+		},
+	},
+	{
+		Name: "retry_wait_time",
+		Env:  "CLI_DO_RETRY_WAIT_TIME",
+		Get:  func(config clido.Config) string { return config.RetryWaitTime.String() },
+		Set: func(config *clido.Config, value string) error {
+			return parseDuration(value, &config.RetryWaitTime)
+		},
+	},
+	{
+		Name: "retry_max_wait_time",
+		Env:  "CLI_DO_RETRY_MAX_WAIT_TIME",
+		Get:  func(config clido.Config) string { return config.RetryMaxWaitTime.String() },
+		Set: func(config *clido.Config, value string) error {
+			return parseDuration(value, &config.RetryMaxWaitTime)
+		},
+	},
+	{
+		Name: "cache_ttl",
+		Env:  "CLI_DO_CACHE_TTL",
+		Get:  func(config clido.Config) string { return config.CacheTTL.String() },
+		Set: func(config *clido.Config, value string) error {
+			return parseDuration(value, &config.CacheTTL)
+		},
+	},
+}
+
+// ConfigValue is one resolved setting and the layer it came from.
+type ConfigValue struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+}
+
+type configLayer struct {
+	source string
+	path   string
+}
+
+// GetConfig resolves the configuration for profile and checks it is usable
+// for talking to the server.
+func GetConfig(ctx *cli.Context, profile string) (clido.Config, error) {
+	config, _, err := LoadConfig(ctx, profile)
+
+	if err != nil {
+		return config, err
+	}
+
+	return config, ValidateConfig(config)
+}
+
+// LoadConfig layers defaults, the system file, the user file, the profile's
+// file, the project's .cli-do-project, CLI_DO_* variables and flags, each
+// overriding the ones before it. A nil ctx skips the project and flag layers.
+func LoadConfig(ctx *cli.Context, profile string) (clido.Config, []ConfigValue, error) {
+	var config = clido.DefaultConfig()
+	var sources = map[string]string{}
+
+	for _, key := range ConfigKeys {
+		sources[key.Name] = ConfigSourceDefault
+	}
+
+	var apply = func(source string, values map[string]string, origin string) error {
+		for _, key := range ConfigKeys {
+			value, ok := values[key.Name]
+
+			if !ok {
+				continue
+			}
+
+			var previous = key.Get(config)
+
+			if err := key.Set(&config, value); err != nil {
+				return NewUsageError("Invalid %s in %s: %s", key.Name, origin, err)
+			}
+
+			if source == ConfigSourceProject && key.Sensitive && key.Get(config) != previous {
+				return NewUsageError("%s sets %s to %q, but a project file cannot change where your credentials are sent. Remove it, or use a profile or --%s for that server.", origin, key.Name, value, key.Flag)
+			}
+
+			sources[key.Name] = source
+		}
+
+		return nil
+	}
+
+	files, err := configFiles(ctx, profile)
+
+	if err != nil {
+		return config, nil, err
+	}
+
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+
+		values, err := readConfigFile(file.path)
+
+		if err != nil {
+			return config, nil, err
+		}
+
+		if err := apply(file.source, values, file.path); err != nil {
+			return config, nil, err
+		}
+	}
+
+	var env = map[string]string{}
+
+	for _, key := range ConfigKeys {
+		if value, ok := os.LookupEnv(key.Env); ok && value != "" {
+			env[key.Name] = value
+		}
+	}
+
+	if err := apply(ConfigSourceEnv, env, "the environment"); err != nil {
+		return config, nil, err
+	}
+
+	if ctx != nil {
+		var flags = map[string]string{}
+
+		for _, key := range ConfigKeys {
+			if key.Flag != "" && isGlobalFlagSet(ctx, key.Flag) {
+				flags[key.Name] = ctx.String(key.Flag)
+			}
+		}
+
+		if err := apply(ConfigSourceFlag, flags, "flags"); err != nil {
+			return config, nil, err
+		}
+	}
+
+	var values []ConfigValue
+
+	for _, key := range ConfigKeys {
+		values = append(values, ConfigValue{Key: key.Name, Value: key.Get(config), Source: sources[key.Name]})
+	}
+
+	return config, values, nil
+}
+
+// configFiles lists the files LoadConfig reads, lowest precedence first. A
+// nil ctx leaves out the project file.
+func configFiles(ctx *cli.Context, profile string) ([]configLayer, error) {
+	userFile, err := ConfigFile(DefaultProfile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files = []configLayer{
+		{source: ConfigSourceSystem, path: SystemConfigFile},
+		{source: ConfigSourceUser, path: userFile},
+	}
+
+	if profile != "" && profile != DefaultProfile {
+		profileFile, err := ConfigFile(profile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, configLayer{source: ConfigSourceProfile, path: profileFile})
+	}
+
+	if ctx != nil {
+		files = append(files, configLayer{source: ConfigSourceProject, path: FindDirectorySettingsFile()})
+	}
+
+	return files, nil
+}
+
+func ValidateConfig(config clido.Config) error {
+	if config.Endpoint == "" {
+		return NewUsageError("No endpoint configured. Run 'cli-do config set endpoint https://...' or set CLI_DO_ENDPOINT.")
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return NewUsageError("Invalid endpoint %q: expected an http or https URL such as https://cli-do.example.com.", config.Endpoint)
+	}
+
+	if config.Timeout.Duration < 0 || config.RetryWaitTime.Duration < 0 || config.RetryMaxWaitTime.Duration < 0 {
+		return NewUsageError("Invalid configuration: timeouts must not be negative.")
+	}
+
+	if config.CacheTTL.Duration < 0 {
+		return NewUsageError("Invalid configuration: cache_ttl must not be negative.")
+	}
+
+	if config.MaxRetries < 0 {
+		return NewUsageError("Invalid configuration: max_retries must not be negative.")
+	}
+
+	return nil
+}
+
+// ConfigDir is the root of everything cli-do stores on disk.
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "cli-do"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".config", "cli-do"), nil
+}
+
+func ConfigFile(profile string) (string, error) {
+	dir, err := ProfileDir(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "config.json"), nil
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	byteValue, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+
+	if err := json.Unmarshal(byteValue, &raw); err != nil {
+		return nil, NewUsageError("Unable to parse %s: %s", path, err)
+	}
+
+	var values = map[string]string{}
+
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+
+	return values, nil
+}
+
+// updateConfigFile rewrites path with the changes update makes, keeping
+// every other setting in it.
+func updateConfigFile(path string, update func(values map[string]interface{})) error {
+	var values = map[string]interface{}{}
+	byteValue, err := os.ReadFile(path)
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if len(byteValue) > 0 {
+		if err := json.Unmarshal(byteValue, &values); err != nil {
+			return NewUsageError("Unable to parse %s: %s", path, err)
+		}
+	}
+
+	update(values)
+
+	return writeConfigFile(path, values)
+}
+
+func writeConfigFile(path string, values map[string]interface{}) error {
+	bytes, err := json.MarshalIndent(values, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(bytes, '\n'), 0644)
+}
+
+// parseDuration accepts a Go duration such as "30s" or a number of seconds,
+// like Duration does in JSON.
+func parseDuration(value string, duration *clido.Duration) error {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		duration.Duration = time.Duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as 30s or 1m", value)
+	}
+
+	duration.Duration = parsed
+
+	return nil
+}
+
+// isGlobalFlagSet ignores subcommand flags of the same name, such as
+// 'profile add --endpoint', which describe something other than the
+// connection for this invocation.
+func isGlobalFlagSet(ctx *cli.Context, name string) bool {
+	var root *cli.Context
+
+	for _, c := range ctx.Lineage() {
+		if c.Command != nil {
+			root = c
+		}
+	}
+
+	return root != nil && root.IsSet(name)
+}
+
+func findConfigKey(name string) (ConfigKey, error) {
+	for _, key := range ConfigKeys {
+		if key.Name == name {
+			return key, nil
+		}
+	}
+
+	var names []string
+
+	for _, key := range ConfigKeys {
+		names = append(names, key.Name)
+	}
+
+	sort.Strings(names)
+
+	return ConfigKey{}, NewUsageError("Unknown config key %q. Valid keys are %s.", name, strings.Join(names, ", "))
+}
+
+func HandleConfigList(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	_, values, err := LoadConfig(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	var items = make([]interface{}, 0, len(values))
+
+	for _, value := range values {
+		items = append(items, value)
+	}
+
+	return Output{
+		Value:   values,
+		Items:   items,
+		Columns: []string{"key", "value", "source"},
+		Record: func(item interface{}) []string {
+			var value = item.(ConfigValue)
+
+			return []string{value.Key, value.Value, value.Source}
+		},
+		Table: func(w io.Writer) {
+			var tbl = table.New("Key", "Value", "Source").WithWriter(w)
+
+			for _, value := range values {
+				tbl.AddRow(value.Key, value.Value, value.Source)
+			}
+
+			tbl.Print()
+		},
+	}.Render(ctx)
+}
+
+func HandleConfigGet(ctx *cli.Context) error {
+	if ctx.Args().First() == "" {
+		return NewUsageError("A config key is required.")
+	}
+
+	key, err := findConfigKey(ctx.Args().First())
+
+	if err != nil {
+		return err
+	}
+
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	config, _, err := LoadConfig(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.App.Writer, key.Get(config))
+
+	return nil
+}
+
+// HandleConfigSet writes a value to the active profile's config file.
+func HandleConfigSet(ctx *cli.Context) error {
+	if ctx.Args().Len() != 2 {
+		return NewUsageError("Usage: cli-do config set <key> <value>")
+	}
+
+	key, err := findConfigKey(ctx.Args().Get(0))
+
+	if err != nil {
+		return err
+	}
+
+	var value = ctx.Args().Get(1)
+	var config = clido.DefaultConfig()
+
+	if err := key.Set(&config, value); err != nil {
+		return NewUsageError("Invalid %s: %s", key.Name, err)
+	}
+
+	if key.Name == "endpoint" {
+		if err := ValidateConfig(config); err != nil {
+			return err
+		}
+	}
+
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	path, err := ConfigFile(profile)
+
+	if err != nil {
+		return err
+	}
+
+	err = updateConfigFile(path, func(values map[string]interface{}) {
+		values[key.Name] = key.Get(config)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "Set %s to %s in %s\n", key.Name, key.Get(config), path)
+
+	return nil
+}
+
+// HandleConfigEdit opens the active profile's config file in $EDITOR and
+// checks the result still parses.
+func HandleConfigEdit(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	path, err := ConfigFile(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := writeConfigFile(path, map[string]interface{}{}); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(EditorPath(), path)
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor exited with an error: %w", err)
+	}
+
+	_, _, err = LoadConfig(ctx, profile)
+
+	if err != nil {
+		return fmt.Errorf("%w\nRun 'cli-do config edit' again to fix %s", err, path)
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Config saved.")
+
+	return nil
+}
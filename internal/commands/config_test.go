@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	var server = setup(t)
+
+	path, _ := ConfigFile(DefaultProfile)
+
+	writeJsonFile(t, path, map[string]string{
+		"endpoint":            server.URL,
+		"retry_max_wait_time": "1ms",
+	})
+
+	writeJsonFile(t, SystemConfigFile, map[string]string{
+		"client_id": "system",
+		"timeout":   "5s",
+	})
+
+	if err := os.WriteFile(".cli-do-project", []byte(`{"project_id": "p", "timeout": 7}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CLI_DO_MAX_RETRIES", "9")
+
+	out, err := run(t, "-o", "json", "--timeout", "11s", "config", "list")
+
+	if err != nil {
+		t.Fatalf("config list: %v", err)
+	}
+
+	var values []ConfigValue
+
+	if err := json.Unmarshal([]byte(out), &values); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+
+	var want = map[string]ConfigValue{
+		"endpoint":            {Value: server.URL, Source: ConfigSourceUser},
+		"client_id":           {Value: "system", Source: ConfigSourceSystem},
+		"timeout":             {Value: "11s", Source: ConfigSourceFlag},
+		"max_retries":         {Value: "9", Source: ConfigSourceEnv},
+		"retry_max_wait_time": {Value: "1ms", Source: ConfigSourceUser},
+	}
+
+	for _, value := range values {
+		expected, ok := want[value.Key]
+
+		if ok && (value.Value != expected.Value || value.Source != expected.Source) {
+			t.Errorf("%s: got %s from %s, want %s from %s", value.Key, value.Value, value.Source, expected.Value, expected.Source)
+		}
+	}
+
+	out, err = run(t, "config", "get", "timeout")
+
+	if err != nil || strings.TrimSpace(out) != "7s" {
+		t.Fatalf("config get timeout: %q, %v", out, err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	setup(t)
+
+	for _, endpoint := range []string{"not a url", "ftp://example.com", "https://"} {
+		t.Setenv("CLI_DO_ENDPOINT", endpoint)
+
+		if _, err := run(t, "project", "list"); ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "Invalid endpoint") {
+			t.Errorf("%q: got %v, want an invalid endpoint error", endpoint, err)
+		}
+	}
+
+	t.Setenv("CLI_DO_ENDPOINT", "")
+	t.Setenv("CLI_DO_TIMEOUT", "soon")
+
+	if _, err := run(t, "project", "list"); ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("got %v, want an invalid timeout error", err)
+	}
+
+	t.Setenv("CLI_DO_TIMEOUT", "")
+
+	path, _ := ConfigFile(DefaultProfile)
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "project", "list"); ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), path) {
+		t.Errorf("got %v, want a parse error naming %s", err, path)
+	}
+
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "project", "list"); ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "No endpoint") {
+		t.Errorf("got %v, want a missing endpoint error", err)
+	}
+}
+
+func TestHandleConfigSet(t *testing.T) {
+	setup(t)
+
+	if _, err := run(t, "config", "set", "timeout", "45"); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+
+	if _, err := run(t, "config", "set", "endpoint", "localhost"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want an invalid endpoint error", err)
+	}
+
+	if _, err := run(t, "config", "set", "colour", "blue"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want an unknown key error", err)
+	}
+
+	out, err := run(t, "config", "get", "timeout")
+
+	if err != nil || strings.TrimSpace(out) != "45s" {
+		t.Fatalf("config get timeout: %q, %v", out, err)
+	}
+
+	if _, err := run(t, "project", "list"); err != nil {
+		t.Fatalf("expected the rest of the config to be kept: %v", err)
+	}
+}
+
+func TestHandleConfigEdit(t *testing.T) {
+	setup(t)
+
+	var editor = filepath.Join(t.TempDir(), "editor.sh")
+	var script = "#!/bin/sh\nsed -i 's/\"timeout\":\"30s\"/\"timeout\":\"2m\"/' \"$1\"\n"
+
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("EDITOR", editor)
+
+	if _, err := run(t, "config", "edit"); err != nil {
+		t.Fatalf("config edit: %v", err)
+	}
+
+	out, err := run(t, "config", "get", "timeout")
+
+	if err != nil || strings.TrimSpace(out) != "2m0s" {
+		t.Fatalf("config get timeout: %q, %v", out, err)
+	}
+
+	script = "#!/bin/sh\necho '{' > \"$1\"\n"
+
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "config", "edit"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want a parse error", err)
+	}
+}
+
+func TestProfileAddEndpointIsNotGlobal(t *testing.T) {
+	var server = setup(t)
+	server.AddProject("Inbox", "")
+
+	if _, err := run(t, "profile", "add", "--endpoint", "https://work.example.com", "work"); err != nil {
+		t.Fatalf("profile add: %v", err)
+	}
+
+	if _, err := run(t, "profile", "add", "--endpoint", "nope", "other"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want an invalid endpoint error", err)
+	}
+
+	out, err := run(t, "config", "get", "endpoint")
+
+	if err != nil || strings.TrimSpace(out) != server.URL {
+		t.Fatalf("config get endpoint: %q, %v", out, err)
+	}
+}
+
+func TestProjectFileCannotRedirectCredentials(t *testing.T) {
+	var server = setup(t)
+	server.AddProject("Inbox", "")
+
+	writeJsonFile(t, ProjectSettingsFile, map[string]interface{}{"project_id": "p", "endpoint": server.URL + "/"})
+
+	if _, err := run(t, "project", "list"); err != nil {
+		t.Fatalf("expected the profile's own endpoint to be accepted, got %v", err)
+	}
+
+	for _, settings := range []map[string]interface{}{
+		{"project_id": "p", "endpoint": "https://attacker.example.com"},
+		{"project_id": "p", "client_id": "someone-else"},
+	} {
+		writeJsonFile(t, ProjectSettingsFile, settings)
+		var requests = server.Requests()
+
+		if _, err := run(t, "project", "list"); ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "cannot change where your credentials are sent") {
+			t.Fatalf("%v: got %v, want the project file to be refused", settings, err)
+		}
+
+		if server.Requests() != requests {
+			t.Fatalf("%v: expected no request to be made", settings)
+		}
+	}
+}
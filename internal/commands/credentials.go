@@ -0,0 +1,552 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	CredentialStoreAuto          = "auto"
+	CredentialStoreSecretService = "secret-service"
+	CredentialStoreFile          = "file"
+)
+
+// CredentialStore keeps the tokens of each profile. Load returns
+// ErrNotLoggedIn when the profile has no saved credentials.
+type CredentialStore interface {
+	Load(profile string) (clido.Auth, error)
+	Save(profile string, auth clido.Auth) error
+	Delete(profile string) error
+}
+
+// NewCredentialStore picks the store named by CLI_DO_CREDENTIAL_STORE. The
+// default uses the store the profile's credentials were last saved in, and
+// otherwise prefers the Secret Service and falls back to an encrypted file.
+func NewCredentialStore(profile string) (CredentialStore, error) {
+	var kind = os.Getenv("CLI_DO_CREDENTIAL_STORE")
+
+	switch kind {
+	case "", CredentialStoreAuto:
+		recorded, err := recordedCredentialStore(profile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if recorded == CredentialStoreSecretService && !SecretServiceAvailable() {
+			return nil, fmt.Errorf("the credentials of profile %s are in the Secret Service, which needs secret-tool and a D-Bus session; log in again with CLI_DO_CREDENTIAL_STORE=file to keep them in a file instead", profile)
+		}
+
+		if recorded == CredentialStoreFile || (recorded == "" && !SecretServiceAvailable()) {
+			return EncryptedFileStore{}, nil
+		}
+
+		return SecretServiceStore{}, nil
+	case CredentialStoreSecretService:
+		if !SecretServiceAvailable() {
+			return nil, errors.New("the Secret Service is not available: secret-tool and a D-Bus session are required")
+		}
+
+		return SecretServiceStore{}, nil
+	case CredentialStoreFile:
+		return EncryptedFileStore{}, nil
+	}
+
+	return nil, NewUsageError("Unknown credential store %q. Use auto, secret-service or file.", kind)
+}
+
+// GetAuth loads the profile's credentials. CLI_DO_TOKEN, with CLI_DO_EMAIL,
+// takes precedence over anything stored so CI can authenticate without a
+// login step.
+func GetAuth(profile string) (clido.Auth, error) {
+	if token := os.Getenv("CLI_DO_TOKEN"); token != "" {
+		return TokenAuth(os.Getenv("CLI_DO_EMAIL"), token), nil
+	}
+
+	store, err := NewCredentialStore(profile)
+
+	if err != nil {
+		return clido.Auth{}, err
+	}
+
+	return store.Load(profile)
+}
+
+// SaveAuth saves the profile's credentials and records which store holds
+// them.
+func SaveAuth(profile string, auth clido.Auth) error {
+	store, err := NewCredentialStore(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if err := store.Save(profile, auth); err != nil {
+		return err
+	}
+
+	var kind = CredentialStoreFile
+
+	if _, ok := store.(SecretServiceStore); ok {
+		kind = CredentialStoreSecretService
+	}
+
+	path, err := credentialStoreRecordPath(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, []byte(kind+"\n"), 0600)
+}
+
+// DeleteAuth forgets the profile's credentials in every store it can reach,
+// whichever one they were saved in, and any plaintext auth.json left over
+// from older versions.
+func DeleteAuth(profile string) error {
+	var errs []error
+
+	if SecretServiceAvailable() {
+		errs = append(errs, SecretServiceStore{}.Delete(profile))
+	}
+
+	errs = append(errs, EncryptedFileStore{}.Delete(profile))
+
+	for _, pathOf := range []func(string) (string, error){legacyAuthPath, credentialStoreRecordPath} {
+		path, err := pathOf(profile)
+
+		if err == nil {
+			err = os.Remove(path)
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// credentialStoreRecordPath is where SaveAuth records which store holds the
+// profile's credentials, so auto finds them again from a session where it
+// would choose differently, such as over SSH without a D-Bus session.
+func credentialStoreRecordPath(profile string) (string, error) {
+	dir, err := ProfileDir(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "credential-store"), nil
+}
+
+// recordedCredentialStore returns the store the profile's credentials were
+// last saved in, or "" when none was recorded.
+func recordedCredentialStore(profile string) (string, error) {
+	path, err := credentialStoreRecordPath(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	byteValue, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(byteValue)), nil
+}
+
+func legacyAuthPath(profile string) (string, error) {
+	dir, err := ProfileDir(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "auth.json"), nil
+}
+
+// MigrateLegacyAuth moves a plaintext auth.json written by older versions
+// for the active profile into the credential store and deletes it. It runs
+// before every command.
+func MigrateLegacyAuth(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		// The command reports the bad profile itself.
+		return nil
+	}
+
+	path, err := legacyAuthPath(profile)
+
+	if err != nil {
+		return err
+	}
+
+	byteValue, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var auth clido.Auth
+
+	if err := json.Unmarshal(byteValue, &auth); err != nil {
+		return fmt.Errorf("unable to read %s, please remove it and log back in: %w", path, err)
+	}
+
+	if err := SaveAuth(profile, auth); err != nil {
+		return fmt.Errorf("unable to migrate %s to the credential store: %w", path, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.App.ErrWriter, "Moved credentials from %s to the credential store.\n", path)
+
+	return nil
+}
+
+// SecretServiceStore keeps credentials in the desktop keyring through
+// libsecret's secret-tool.
+type SecretServiceStore struct{}
+
+func SecretServiceAvailable() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+
+	_, err := exec.LookPath("secret-tool")
+
+	return err == nil
+}
+
+func (SecretServiceStore) Load(profile string) (clido.Auth, error) {
+	var auth clido.Auth
+	var stdout bytes.Buffer
+
+	var cmd = exec.Command("secret-tool", "lookup", "service", "cli-do", "profile", profile)
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		var exitError *exec.ExitError
+
+		if errors.As(err, &exitError) && stdout.Len() == 0 {
+			return auth, ErrNotLoggedIn
+		}
+
+		return auth, fmt.Errorf("unable to read credentials from the Secret Service: %w", err)
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &auth); err != nil {
+		return auth, fmt.Errorf("unable to read credentials from the Secret Service, please log back in: %w", err)
+	}
+
+	return auth, nil
+}
+
+func (SecretServiceStore) Save(profile string, auth clido.Auth) error {
+	secret, err := json.Marshal(auth)
+
+	if err != nil {
+		return err
+	}
+
+	var cmd = exec.Command("secret-tool", "store", "--label", fmt.Sprintf("cli-do (%s)", profile), "service", "cli-do", "profile", profile)
+	cmd.Stdin = bytes.NewReader(secret)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to save credentials to the Secret Service: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+
+	return nil
+}
+
+func (SecretServiceStore) Delete(profile string) error {
+	var cmd = exec.Command("secret-tool", "clear", "service", "cli-do", "profile", profile)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to remove credentials from the Secret Service: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+
+	return nil
+}
+
+// EncryptedFileStore writes each profile's credentials to auth.enc, sealed
+// with AES-256-GCM. The key is derived with scrypt from CLI_DO_PASSPHRASE
+// when set, otherwise it is read from CLI_DO_KEY_FILE or a key file generated
+// in the config directory.
+//
+// The generated key file sits next to auth.enc, so anyone who can read one
+// can read the other: it only keeps the tokens out of a copy of auth.enc
+// alone, such as one pasted into a bug report. Real protection needs the
+// passphrase or a key file kept elsewhere.
+type EncryptedFileStore struct{}
+
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	Kdf        string `json:"kdf"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+const (
+	kdfScrypt  = "scrypt"
+	kdfKeyFile = "key-file"
+)
+
+func (store EncryptedFileStore) path(profile string) (string, error) {
+	dir, err := ProfileDir(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "auth.enc"), nil
+}
+
+func (store EncryptedFileStore) Load(profile string) (clido.Auth, error) {
+	var auth clido.Auth
+
+	path, err := store.path(profile)
+
+	if err != nil {
+		return auth, err
+	}
+
+	byteValue, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return auth, ErrNotLoggedIn
+	}
+
+	if err != nil {
+		return auth, err
+	}
+
+	var file encryptedFile
+
+	if err := json.Unmarshal(byteValue, &file); err != nil {
+		return auth, fmt.Errorf("unable to read %s, please log back in: %w", path, err)
+	}
+
+	key, err := encryptionKey(file.Kdf, file.Salt, false)
+
+	if err != nil {
+		return auth, err
+	}
+
+	gcm, err := newGcm(key)
+
+	if err != nil {
+		return auth, err
+	}
+
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+
+	if err != nil {
+		return auth, fmt.Errorf("unable to decrypt %s, check CLI_DO_PASSPHRASE or CLI_DO_KEY_FILE: %w", path, err)
+	}
+
+	if err := json.Unmarshal(plaintext, &auth); err != nil {
+		return auth, fmt.Errorf("unable to read %s, please log back in: %w", path, err)
+	}
+
+	return auth, nil
+}
+
+func (store EncryptedFileStore) Save(profile string, auth clido.Auth) error {
+	path, err := store.path(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	var file = encryptedFile{
+		Version: 1,
+		Kdf:     kdfKeyFile,
+		Nonce:   make([]byte, 12),
+	}
+
+	if os.Getenv("CLI_DO_PASSPHRASE") != "" {
+		file.Kdf = kdfScrypt
+		file.Salt = make([]byte, 16)
+
+		if _, err := rand.Read(file.Salt); err != nil {
+			return err
+		}
+	}
+
+	key, err := encryptionKey(file.Kdf, file.Salt, true)
+
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGcm(key)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(auth)
+
+	if err != nil {
+		return err
+	}
+
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, nil)
+
+	bytes, err := json.Marshal(file)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, bytes, 0600)
+}
+
+func (store EncryptedFileStore) Delete(profile string) error {
+	path, err := store.path(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func encryptionKey(kdf string, salt []byte, create bool) ([]byte, error) {
+	switch kdf {
+	case kdfScrypt:
+		var passphrase = os.Getenv("CLI_DO_PASSPHRASE")
+
+		if passphrase == "" {
+			return nil, errors.New("credentials are protected by a passphrase, set CLI_DO_PASSPHRASE to unlock them")
+		}
+
+		return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	case kdfKeyFile:
+		return readKeyFile(create)
+	}
+
+	return nil, fmt.Errorf("unknown key derivation %q", kdf)
+}
+
+func readKeyFile(create bool) ([]byte, error) {
+	var path = os.Getenv("CLI_DO_KEY_FILE")
+
+	if path == "" {
+		dir, err := ConfigDir()
+
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(dir, "credentials.key")
+	}
+
+	key, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) && create {
+		key = make([]byte, 32)
+
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+
+		err = writeFileAtomic(path, key, 0600)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key file %s: %w", path, err)
+	}
+
+	var sum = sha256.Sum256(key)
+
+	return sum[:], nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic replaces path so readers never see a partially written
+// file, and so perm applies even when the file already existed.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/streed/cli-do-client/clido"
+)
+
+func TestMigrateLegacyAuth(t *testing.T) {
+	var server = setup(t)
+	server.AddProject("Inbox", "")
+
+	dir, _ := ProfileDir(DefaultProfile)
+
+	if err := DeleteAuth(DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+
+	writeJsonFile(t, filepath.Join(dir, "auth.json"), server.Authorize("reed@example.com"))
+
+	out, err := run(t, "project", "list")
+
+	if err != nil {
+		t.Fatalf("project list: %v", err)
+	}
+
+	if !strings.Contains(out, "Moved credentials from") {
+		t.Fatalf("expected the migration to be reported in %q", out)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "auth.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected auth.json to be removed, got %v", err)
+	}
+
+	for _, name := range []string{"auth.enc", "credentials.key"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("%s has mode %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+}
+
+func TestEncryptedFileStorePassphrase(t *testing.T) {
+	setup(t)
+	t.Setenv("CLI_DO_PASSPHRASE", "correct horse")
+
+	var auth = clido.Auth{Email: "reed@example.com", AccessToken: "secret"}
+
+	if err := SaveAuth(DefaultProfile, auth); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, _ := ProfileDir(DefaultProfile)
+	bytes, _ := os.ReadFile(filepath.Join(dir, "auth.enc"))
+
+	if len(bytes) == 0 || strings.Contains(string(bytes), "secret") {
+		t.Fatalf("expected encrypted credentials, got %q", bytes)
+	}
+
+	if loaded, err := GetAuth(DefaultProfile); err != nil || loaded != auth {
+		t.Fatalf("got %+v, %v", loaded, err)
+	}
+
+	t.Setenv("CLI_DO_PASSPHRASE", "wrong")
+
+	if _, err := GetAuth(DefaultProfile); err == nil {
+		t.Fatal("expected the wrong passphrase to fail")
+	}
+
+	t.Setenv("CLI_DO_PASSPHRASE", "")
+
+	if _, err := GetAuth(DefaultProfile); err == nil {
+		t.Fatal("expected a missing passphrase to fail")
+	}
+}
+
+func TestCredentialStoreIsRecordedPerProfile(t *testing.T) {
+	setup(t)
+	t.Setenv("CLI_DO_CREDENTIAL_STORE", CredentialStoreAuto)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+
+	var auth = clido.Auth{Email: "reed@example.com", AccessToken: "secret"}
+
+	if err := SaveAuth(DefaultProfile, auth); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorded, _ := recordedCredentialStore(DefaultProfile); recorded != CredentialStoreFile {
+		t.Fatalf("got recorded store %q, want %q", recorded, CredentialStoreFile)
+	}
+
+	// Credentials saved to the keyring from a desktop session are not
+	// silently missing from one without it.
+	path, _ := credentialStoreRecordPath(DefaultProfile)
+
+	if err := os.WriteFile(path, []byte(CredentialStoreSecretService), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetAuth(DefaultProfile); err == nil || errors.Is(err, ErrNotLoggedIn) || !strings.Contains(err.Error(), "Secret Service") {
+		t.Fatalf("got %v, want an error naming the Secret Service", err)
+	}
+
+	if err := DeleteAuth(DefaultProfile); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, err := GetAuth(DefaultProfile); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("got %v, want ErrNotLoggedIn", err)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the record to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/streed/cli-do-client/clido"
+)
+
+// ErrNotLoggedIn is returned when the profile has no saved credentials.
+var ErrNotLoggedIn = errors.New("not logged in, run 'cli-do login'")
+
+// NotFoundError reports a reference that matched nothing the account can
+// see. It is clido.ErrNotFound for errors.Is, so it exits like a 404.
+type NotFoundError struct {
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == clido.ErrNotFound
+}
+
+func NewNotFoundError(format string, args ...interface{}) error {
+	return &NotFoundError{Message: fmt.Sprintf(format, args...)}
+}
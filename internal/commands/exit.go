@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes returned by the cli-do binary. Scripts may rely on these values.
+const (
+	ExitOK          = 0
+	ExitError       = 1
+	ExitUsage       = 2
+	ExitAuth        = 3
+	ExitNotFound    = 4
+	ExitNetwork     = 5
+	ExitServer      = 6
+	ExitInterrupted = 130
+)
+
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func NewUsageError(format string, args ...interface{}) error {
+	return &UsageError{Message: fmt.Sprintf(format, args...)}
+}
+
+func HandleUsageError(ctx *cli.Context, err error, isSubcommand bool) error {
+	_ = cli.ShowSubcommandHelp(ctx)
+
+	return NewUsageError("Incorrect Usage: %s", err)
+}
+
+func ExitCode(err error) int {
+	var usageError *UsageError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &usageError), errors.Is(err, clido.ErrValidation):
+		return ExitUsage
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.Is(err, clido.ErrUnauthorized), errors.Is(err, clido.ErrForbidden), errors.Is(err, ErrNotLoggedIn),
+		errors.Is(err, clido.ErrAccessDenied), errors.Is(err, clido.ErrCodeExpired):
+		return ExitAuth
+	case errors.Is(err, clido.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, clido.ErrServer), errors.Is(err, clido.ErrRateLimited):
+		return ExitServer
+	case errors.Is(err, ErrOffline), isNetworkError(err):
+		return ExitNetwork
+	}
+
+	return ExitError
+}
+
+// isNetworkError reports whether err means the server could not be reached
+// or did not answer in time.
+func isNetworkError(err error) bool {
+	var netError net.Error
+
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netError)
+}
+
+// isUnreachable reports whether err means a request never reached the
+// server, so it can safely be queued and sent again later.
+func isUnreachable(err error) bool {
+	var opError *net.OpError
+
+	return errors.As(err, &opError) && opError.Op == "dial"
+}
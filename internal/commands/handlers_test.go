@@ -0,0 +1,909 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+// setup points the cli-do config and credentials at a fresh fake server and
+// runs the test from an empty working directory.
+func setup(t *testing.T) *clidotest.Server {
+	t.Helper()
+
+	var server = clidotest.NewServer()
+	t.Cleanup(server.Close)
+
+	var home = t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+
+	for _, key := range ConfigKeys {
+		t.Setenv(key.Env, "")
+	}
+
+	var systemConfigFile = SystemConfigFile
+	SystemConfigFile = filepath.Join(home, "system-config.json")
+	t.Cleanup(func() { SystemConfigFile = systemConfigFile })
+	t.Setenv("CLI_DO_PROFILE", "")
+	t.Setenv("CLI_DO_PROJECT_BOUNDARY", "")
+	t.Setenv("CLI_DO_OFFLINE", "")
+	t.Setenv("CLI_DO_VERBOSE", "")
+
+	var dir = filepath.Join(home, ".config", "cli-do")
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var config = clido.DefaultConfig()
+	config.Endpoint = server.URL
+	config.RetryWaitTime = clido.Duration{Duration: time.Millisecond}
+	config.RetryMaxWaitTime = clido.Duration{Duration: time.Millisecond}
+	config.CacheTTL = clido.Duration{}
+
+	writeJsonFile(t, filepath.Join(dir, "config.json"), config)
+
+	t.Setenv("CLI_DO_CREDENTIAL_STORE", CredentialStoreFile)
+	t.Setenv("CLI_DO_PASSPHRASE", "")
+	t.Setenv("CLI_DO_KEY_FILE", "")
+	t.Setenv("CLI_DO_TOKEN", "")
+	t.Setenv("CLI_DO_EMAIL", "")
+
+	if err := SaveAuth(DefaultProfile, clido.Auth(server.Authorize("reed@example.com"))); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "false")
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	return server
+}
+
+// todoFiles lists the todo files left in the temp directory.
+func todoFiles() []string {
+	var files, _ = filepath.Glob(filepath.Join(os.TempDir(), "cli-do-todo-*"))
+
+	return files
+}
+
+func writeJsonFile(t *testing.T, path string, v interface{}) {
+	t.Helper()
+
+	bytes, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, bytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// run executes args against the cli-do command tree and returns what the
+// command rendered.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	return runWithInput(t, "", args...)
+}
+
+func runWithInput(t *testing.T, input string, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	var app = NewApp()
+	app.Reader = strings.NewReader(input)
+	app.Writer = &out
+	app.ErrWriter = &out
+
+	var err = app.RunContext(context.Background(), append([]string{"cli-do"}, args...))
+
+	return out.String(), err
+}
+
+func TestHandleLoginAlreadyLoggedIn(t *testing.T) {
+	var server = setup(t)
+	var before, _ = GetAuth(DefaultProfile)
+	var requests = server.Requests()
+
+	out, err := run(t, "login")
+
+	if err != nil || !strings.Contains(out, "You are already logged in!") {
+		t.Fatalf("login: %q, %v", out, err)
+	}
+
+	if after, _ := GetAuth(DefaultProfile); after != before {
+		t.Fatalf("expected the stored credentials to be kept, got %+v", after)
+	}
+
+	if server.Requests() != requests {
+		t.Fatalf("expected no requests, got %d", server.Requests()-requests)
+	}
+}
+
+func TestRefreshOnRevokedToken(t *testing.T) {
+	var server = setup(t)
+	server.AddProject("Inbox", "")
+
+	auth, _ := GetAuth(DefaultProfile)
+	server.Revoke(auth.AccessToken)
+
+	out, err := run(t, "-o", "json", "project", "list")
+
+	if err != nil {
+		t.Fatalf("project list: %v", err)
+	}
+
+	if !strings.Contains(out, "Inbox") {
+		t.Fatalf("expected Inbox in %q", out)
+	}
+
+	refreshed, _ := GetAuth(DefaultProfile)
+
+	if refreshed.AccessToken == auth.AccessToken {
+		t.Fatal("expected refreshed credentials to be saved")
+	}
+}
+
+func TestHandleProjectNewAndList(t *testing.T) {
+	setup(t)
+
+	if _, err := run(t, "project", "new", "--name", "Inbox", "--description", "Everything"); err != nil {
+		t.Fatalf("project new: %v", err)
+	}
+
+	out, err := run(t, "-o", "json", "project", "list")
+
+	if err != nil {
+		t.Fatalf("project list: %v", err)
+	}
+
+	var projects []clido.Project
+
+	if err := json.Unmarshal([]byte(out), &projects); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+
+	if len(projects) != 1 || projects[0].Name != "Inbox" || projects[0].Description != "Everything" {
+		t.Fatalf("unexpected projects %+v", projects)
+	}
+}
+
+func TestHandleProjectNewValidation(t *testing.T) {
+	setup(t)
+
+	_, err := run(t, "project", "new")
+
+	if ExitCode(err) != ExitUsage {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitUsage)
+	}
+}
+
+func TestHandleProjectArchive(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	if _, err := run(t, "project", "archive", project.Id); err != nil {
+		t.Fatalf("project archive: %v", err)
+	}
+
+	if stored, _ := server.Project(project.Id); !stored.Archived {
+		t.Fatal("expected project to be archived")
+	}
+
+	_, err := run(t, "project", "archive", project.Id)
+
+	if !errors.Is(err, clido.ErrNotFound) || ExitCode(err) != ExitNotFound {
+		t.Fatalf("archiving twice: got %v, want clido.ErrNotFound", err)
+	}
+}
+
+func TestHandleInitProjectDirectory(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	if _, err := run(t, "project", "init", project.Id); err != nil {
+		t.Fatalf("project init: %v", err)
+	}
+
+	bytes, err := os.ReadFile(".cli-do-project")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var settings DirectorySettings
+
+	if err := json.Unmarshal(bytes, &settings); err != nil || settings.ProjectId != project.Id {
+		t.Fatalf("unexpected settings %q", bytes)
+	}
+
+	if _, err := run(t, "todo", "list"); err != nil {
+		t.Fatalf("todo list in initialized directory: %v", err)
+	}
+}
+
+func TestProjectFileInParentDirectory(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Done already", Completed: true})
+
+	writeJsonFile(t, ProjectSettingsFile, DirectorySettings{
+		ProjectId: project.Id,
+		Output:    OutputJson,
+		Filters:   TodoFilters{All: true},
+	})
+
+	wd, _ := os.Getwd()
+	var path = filepath.Join(wd, ProjectSettingsFile)
+
+	if err := os.MkdirAll(filepath.Join("src", "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(filepath.Join("src", "pkg")); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, "--verbose", "todo", "list")
+
+	if err != nil {
+		t.Fatalf("todo list in a subdirectory: %v", err)
+	}
+
+	if !strings.Contains(out, "Using project settings from "+path) {
+		t.Fatalf("expected verbose mode to name %s, got %q", path, out)
+	}
+
+	if !strings.Contains(out, `"subject": "Done already"`) {
+		t.Fatalf("expected the project's output format and filters, got %q", out)
+	}
+}
+
+func TestFindDirectorySettingsFileBoundary(t *testing.T) {
+	setup(t)
+
+	var root = t.TempDir()
+	var home = filepath.Join(root, "home")
+	var repo = filepath.Join(home, "repo")
+	var wd = filepath.Join(repo, "src")
+
+	for _, dir := range []string{wd, filepath.Join(repo, ".git")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("HOME", home)
+
+	var above = filepath.Join(root, ProjectSettingsFile)
+	writeJsonFile(t, above, DirectorySettings{ProjectId: "outside"})
+
+	if path := FindDirectorySettingsFile(); path != "" {
+		t.Fatalf("expected the search to stop at $HOME, found %s", path)
+	}
+
+	t.Setenv("CLI_DO_PROJECT_BOUNDARY", ProjectBoundaryRoot)
+
+	if path := FindDirectorySettingsFile(); path != above {
+		t.Fatalf("got %q, want %s", path, above)
+	}
+
+	var inHome = filepath.Join(home, ProjectSettingsFile)
+	writeJsonFile(t, inHome, DirectorySettings{ProjectId: "home"})
+	t.Setenv("CLI_DO_PROJECT_BOUNDARY", ProjectBoundaryGit)
+
+	if path := FindDirectorySettingsFile(); path != "" {
+		t.Fatalf("expected the search to stop at the git root, found %s", path)
+	}
+
+	t.Setenv("CLI_DO_PROJECT_BOUNDARY", "")
+
+	if path := FindDirectorySettingsFile(); path != inHome {
+		t.Fatalf("got %q, want %s", path, inHome)
+	}
+}
+
+func TestResolveProject(t *testing.T) {
+	var server = setup(t)
+	var inbox = server.AddProject("Inbox", "")
+	var work = server.AddProject("Work", "")
+	var workshop = server.AddProject("Workshop", "")
+
+	for _, project := range []clidotest.Project{inbox, work, workshop} {
+		_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: project.Name})
+	}
+
+	var cases = map[string]string{
+		inbox.Id:                   "Inbox",
+		strconv.Itoa(inbox.Ticket): "Inbox",
+		"Work":                     "Work",
+		"work":                     "Work",
+		"inb":                      "Inbox",
+	}
+
+	for ref, want := range cases {
+		out, err := run(t, "-p", ref, "--format", "{{.Subject}}", "todo", "list")
+
+		if err != nil {
+			t.Errorf("%q: %v", ref, err)
+			continue
+		}
+
+		if strings.TrimSpace(out) != want {
+			t.Errorf("%q: listed %q, want the todos of %s", ref, out, want)
+		}
+	}
+
+	_, err := run(t, "-p", "wor", "todo", "list")
+
+	if ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "Workshop") {
+		t.Fatalf("got %v, want an ambiguous project error listing the candidates", err)
+	}
+
+	if _, err := run(t, "project", "archive", "Missing"); ExitCode(err) != ExitNotFound {
+		t.Fatalf("got %v, want a not found error", err)
+	}
+
+	if _, err := run(t, "project", "archive", "workshop"); err != nil {
+		t.Fatalf("project archive by name: %v", err)
+	}
+}
+
+func TestGlobalTodoReference(t *testing.T) {
+	var server = setup(t)
+
+	if _, err := run(t, "project", "new", "--name", "Operations", "--key", "ops"); err != nil {
+		t.Fatalf("project new: %v", err)
+	}
+
+	if _, err := run(t, "-p", "OPS", "todo", "new", "--subject", "Rotate keys"); err != nil {
+		t.Fatalf("todo new with a project key: %v", err)
+	}
+
+	out, err := run(t, "--format", "{{.Subject}}", "todo", "get", "OPS-1")
+
+	if err != nil || strings.TrimSpace(out) != "Rotate keys" {
+		t.Fatalf("todo get OPS-1: %q, %v", out, err)
+	}
+
+	var before = server.Requests()
+
+	if out, err := run(t, "todo", "complete", "ops-1"); err != nil || !strings.Contains(out, "Todo completed successfully!") {
+		t.Fatalf("todo complete ops-1: %q, %v", out, err)
+	}
+
+	if requests := server.Requests() - before; requests != 1 {
+		t.Fatalf("expected the key to come from the cache, made %d requests", requests)
+	}
+
+	if _, err := run(t, "todo", "get", "NOPE-1"); ExitCode(err) != ExitNotFound {
+		t.Fatalf("got %v, want a not found error", err)
+	}
+
+	if _, err := run(t, "project", "new", "--name", "Other", "--key", "OPS"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want a duplicate key error", err)
+	}
+}
+
+func TestProjectKeyDerivedByClient(t *testing.T) {
+	setup(t)
+
+	for range 2 {
+		if _, err := run(t, "project", "new", "--name", "Operations team"); err != nil {
+			t.Fatalf("project new: %v", err)
+		}
+	}
+
+	out, err := run(t, "--format", "{{.Key}}", "project", "list")
+
+	if err != nil || strings.Fields(out)[0] != "OPER" || strings.Fields(out)[1] != "OPER2" {
+		t.Fatalf("expected the keys OPER and OPER2, got %q, %v", out, err)
+	}
+
+	if _, err := run(t, "-p", "OPER2", "todo", "new", "--subject", "Rotate keys"); err != nil {
+		t.Fatalf("todo new: %v", err)
+	}
+
+	if out, err := run(t, "--format", "{{.Subject}}", "todo", "get", "OPER2-1"); err != nil || strings.TrimSpace(out) != "Rotate keys" {
+		t.Fatalf("todo get OPER2-1: %q, %v", out, err)
+	}
+}
+
+func TestStaleProjectKeyIsRefreshed(t *testing.T) {
+	var server = setup(t)
+	var old = server.AddProject("Operations", "")
+	_, _ = server.AddTodo(old.Id, clidotest.Todo{Subject: "Old todo"})
+
+	if out, err := run(t, "--format", "{{.Subject}}", "todo", "get", "OPER-1"); err != nil || strings.TrimSpace(out) != "Old todo" {
+		t.Fatalf("todo get OPER-1: %q, %v", out, err)
+	}
+
+	// Archiving frees the key for a new project while the old Id is cached.
+	if _, err := run(t, "project", "archive", old.Id); err != nil {
+		t.Fatalf("project archive: %v", err)
+	}
+
+	var current = server.AddProject("Operations", "")
+	_, _ = server.AddTodo(current.Id, clidotest.Todo{Subject: "New todo"})
+
+	if out, err := run(t, "--format", "{{.Subject}}", "todo", "get", "OPER-1"); err != nil || strings.TrimSpace(out) != "New todo" {
+		t.Fatalf("todo get OPER-1 after the key moved: %q, %v", out, err)
+	}
+
+	if _, err := run(t, "todo", "complete", "OPER-1"); err != nil {
+		t.Fatalf("todo complete OPER-1: %v", err)
+	}
+
+	if todo, _ := server.Todo(current.Id, 1); !todo.Completed {
+		t.Fatalf("expected the todo of the new project to be completed, got %+v", todo)
+	}
+}
+
+func TestTodoListFilters(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	var date = func(value string) *time.Time {
+		var due, _ = time.Parse("2006-01-02", value)
+		return &due
+	}
+
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Deploy api", DueDate: date("2026-10-20")})
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk", DueDate: date("2026-10-01")})
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Deploy web", DueDate: date("2026-12-01")})
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Archive logs", Body: "after the deploy"})
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Deploy docs", Completed: true})
+
+	var cases = []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--grep", "deploy", "--due-before", "2026-11-01"}, "Deploy api"},
+		{[]string{"--grep", "deploy", "--sort", "due"}, "Deploy api,Deploy web,Archive logs"},
+		{[]string{"--sort", "subject", "--reverse"}, "Deploy web,Deploy api,Buy milk,Archive logs"},
+		{[]string{"--due-after", "2026-10-01"}, "Deploy api,Deploy web"},
+		{[]string{"--completed"}, "Deploy docs"},
+	}
+
+	for _, c := range cases {
+		var args = append([]string{"-p", project.Id, "--format", "{{.Subject}},", "todo", "list"}, c.args...)
+		out, err := run(t, args...)
+
+		if err != nil {
+			t.Errorf("%v: %v", c.args, err)
+			continue
+		}
+
+		if got := strings.TrimSuffix(strings.ReplaceAll(out, "\n", ""), ","); got != c.want {
+			t.Errorf("%v: got %q, want %q", c.args, got, c.want)
+		}
+	}
+
+	if _, err := run(t, "-p", project.Id, "todo", "list", "--sort", "priority"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want an unknown sort error", err)
+	}
+}
+
+func TestHandleInitProjectDirectoryNotFound(t *testing.T) {
+	setup(t)
+
+	_, err := run(t, "project", "init", "missing")
+
+	if ExitCode(err) != ExitNotFound {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitNotFound)
+	}
+}
+
+func TestHandleCreateTodoAndList(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	if _, err := run(t, "-p", project.Id, "todo", "new", "--subject", "Buy milk", "--due-date", "2030-01-02"); err != nil {
+		t.Fatalf("todo new: %v", err)
+	}
+
+	out, err := run(t, "-p", project.Id, "--format", "{{.Ticket}} {{.Subject}}", "todo", "list")
+
+	if err != nil {
+		t.Fatalf("todo list: %v", err)
+	}
+
+	if out != "1 Buy milk\n" {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	todo, _ := server.Todo(project.Id, 1)
+
+	if todo.DueDate == nil || todo.DueDate.Format("2006-01-02") != "2030-01-02" {
+		t.Fatalf("unexpected due date %v", todo.DueDate)
+	}
+}
+
+func TestHandleCreateTodoValidation(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	_, err := run(t, "-p", project.Id, "todo", "new", "--subject", " ")
+
+	var apiError *clido.ApiError
+
+	if !errors.As(err, &apiError) || len(apiError.FieldErrors) != 1 || apiError.FieldErrors[0].Field != "subject" {
+		t.Fatalf("got %v, want a subject validation error", err)
+	}
+
+	if ExitCode(err) != ExitUsage {
+		t.Fatalf("got exit code %d, want %d", ExitCode(err), ExitUsage)
+	}
+}
+
+func TestHandleTodosListAll(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Open"})
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Done", Completed: true})
+
+	out, err := run(t, "-p", project.Id, "-o", "csv", "todo", "list")
+
+	if err != nil {
+		t.Fatalf("todo list: %v", err)
+	}
+
+	if strings.Contains(out, "Done") || !strings.Contains(out, "Open") {
+		t.Fatalf("expected only open todos in %q", out)
+	}
+
+	out, err = run(t, "-p", project.Id, "-o", "csv", "todo", "list", "--all")
+
+	if err != nil {
+		t.Fatalf("todo list --all: %v", err)
+	}
+
+	if !strings.Contains(out, "Done") || !strings.Contains(out, "Open") {
+		t.Fatalf("expected every todo in %q", out)
+	}
+}
+
+func TestTsvOutputEscapesFields(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Say \"hi\"\tthere", Body: "Line one\r\nC:\\temp"})
+
+	out, err := run(t, "-p", project.Id, "-o", "tsv", "todo", "list")
+
+	if err != nil {
+		t.Fatalf("todo list: %v", err)
+	}
+
+	var lines = strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+
+	if len(lines) != 2 || lines[0] != "ticket\tsubject\tbody\tdue_date\tcompleted\tpast_due" {
+		t.Fatalf("expected a header and one row, got %q", out)
+	}
+
+	if fields := strings.Split(lines[1], "\t"); len(fields) != 6 || fields[1] != `Say "hi"\tthere` || fields[2] != `Line one\r\nC:\\temp` {
+		t.Fatalf("unexpected row %q", lines[1])
+	}
+}
+
+func TestHandleTodosListRequiresProject(t *testing.T) {
+	setup(t)
+
+	_, err := run(t, "todo", "list")
+
+	if ExitCode(err) != ExitUsage {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitUsage)
+	}
+}
+
+func TestHandleGetTodo(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk", Body: "Oat"})
+
+	out, err := run(t, "-p", project.Id, "todo", "get", "1")
+
+	if err != nil {
+		t.Fatalf("todo get: %v", err)
+	}
+
+	if !strings.Contains(out, "Subject: Buy milk") || !strings.Contains(out, "Oat") {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	_, err = run(t, "-p", project.Id, "todo", "get", "2")
+
+	if ExitCode(err) != ExitNotFound {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitNotFound)
+	}
+
+	_, err = run(t, "-p", project.Id, "todo", "get")
+
+	if ExitCode(err) != ExitUsage {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitUsage)
+	}
+}
+
+func TestHandleEditTodo(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk", Body: "Oat"})
+
+	var editor = filepath.Join(t.TempDir(), "editor.sh")
+	var script = "#!/bin/sh\nsed -i 's/subject: Buy milk/subject: Buy bread/; s/Oat/Rye/' \"$1\"\n"
+
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("EDITOR", editor)
+
+	if _, err := run(t, "-p", project.Id, "todo", "edit", "1"); err != nil {
+		t.Fatalf("todo edit: %v", err)
+	}
+
+	todo, _ := server.Todo(project.Id, 1)
+
+	if todo.Subject != "Buy bread" || todo.Body != "Rye" {
+		t.Fatalf("unexpected todo %+v", todo)
+	}
+
+	if leftovers := todoFiles(); len(leftovers) != 0 {
+		t.Fatalf("expected temp file to be removed, found %v", leftovers)
+	}
+}
+
+func TestHandleEditTodoKeepsChangesOnFailure(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	var editor = filepath.Join(t.TempDir(), "editor.sh")
+
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\nsed -i 's/Buy milk/Buy bread/' \"$1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("EDITOR", editor)
+	server.FailNext(0, http.StatusUnprocessableEntity)
+
+	_, err := run(t, "-p", project.Id, "todo", "edit", "1")
+
+	if !errors.Is(err, clido.ErrValidation) {
+		t.Fatalf("got %v, want clido.ErrValidation", err)
+	}
+
+	if leftovers := todoFiles(); len(leftovers) != 1 {
+		t.Fatalf("expected the edited file to be kept, found %v", leftovers)
+	}
+}
+
+func TestHandleEditTodoUnchanged(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk", Body: "Oat\n"})
+
+	// Closing the editor without saving leaves the todo as it was.
+	t.Setenv("EDITOR", "true")
+	var requests = server.Requests()
+
+	out, err := run(t, "-p", project.Id, "todo", "edit", "1")
+
+	if err != nil || !strings.Contains(out, "No changes.") {
+		t.Fatalf("todo edit: %q, %v", out, err)
+	}
+
+	if server.Requests() != requests+1 {
+		t.Fatalf("expected only the todo to be read, got %d requests", server.Requests()-requests)
+	}
+
+	if leftovers := todoFiles(); len(leftovers) != 0 {
+		t.Fatalf("expected the file to be removed, found %v", leftovers)
+	}
+}
+
+func TestHandleArchiveTodo(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	if _, err := run(t, "-p", project.Id, "todo", "archive", "1"); err != nil {
+		t.Fatalf("todo archive: %v", err)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); !todo.Archived {
+		t.Fatal("expected todo to be archived")
+	}
+
+	_, err := run(t, "-p", project.Id, "todo", "archive", "1")
+
+	if ExitCode(err) != ExitNotFound {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitNotFound)
+	}
+}
+
+func TestHandleCompleteTodo(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	if _, err := run(t, "-p", project.Id, "todo", "complete", "1"); err != nil {
+		t.Fatalf("todo complete: %v", err)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); !todo.Completed {
+		t.Fatal("expected todo to be completed")
+	}
+}
+
+func TestRetriesServerErrorsOnReads(t *testing.T) {
+	var server = setup(t)
+	server.AddProject("Inbox", "")
+	server.FailNext(http.StatusServiceUnavailable, http.StatusBadGateway)
+
+	if _, err := run(t, "project", "list"); err != nil {
+		t.Fatalf("project list: %v", err)
+	}
+
+	if server.Requests() != 3 {
+		t.Fatalf("got %d requests, want 3", server.Requests())
+	}
+}
+
+func TestDoesNotRetryServerErrorsOnPosts(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	server.FailNext(http.StatusInternalServerError)
+
+	_, err := run(t, "-p", project.Id, "todo", "new", "--subject", "Buy milk")
+
+	if ExitCode(err) != ExitServer {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitServer)
+	}
+
+	if server.Requests() != 1 {
+		t.Fatalf("got %d requests, want 1", server.Requests())
+	}
+}
+
+func TestHandleLoginPasswordStdin(t *testing.T) {
+	var server = setup(t)
+	server.AddUser("ci@example.com", "hunter2")
+
+	_, err := runWithInput(t, "wrong\n", "login", "--email", "ci@example.com", "--password-stdin")
+
+	if ExitCode(err) != ExitAuth {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitAuth)
+	}
+
+	if _, err := runWithInput(t, "hunter2\n", "login", "--email", "ci@example.com", "--password-stdin"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	auth, _ := GetAuth(DefaultProfile)
+
+	if auth.Email != "ci@example.com" {
+		t.Fatalf("unexpected auth %+v", auth)
+	}
+
+	if _, err := runWithInput(t, "hunter2", "login", "--password-stdin"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want a usage error without --email", err)
+	}
+}
+
+func TestHandleLoginRequiresTerminal(t *testing.T) {
+	setup(t)
+
+	if _, err := run(t, "login", "--force"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want a usage error", err)
+	}
+}
+
+func TestHandleLoginTokenStdin(t *testing.T) {
+	var server = setup(t)
+	var token = server.Authorize("ci@example.com").AccessToken
+
+	if _, err := runWithInput(t, "bogus\n", "login", "--token-stdin"); ExitCode(err) != ExitAuth {
+		t.Fatalf("got %v, want an auth error", err)
+	}
+
+	if _, err := runWithInput(t, token+"\n", "login", "--email", "ci@example.com", "--token-stdin"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	auth, _ := GetAuth(DefaultProfile)
+
+	if auth.AccessToken != token || auth.RefreshToken != "" {
+		t.Fatalf("unexpected auth %+v", auth)
+	}
+}
+
+func TestTokenEnvironment(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	if err := DeleteAuth(DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CLI_DO_TOKEN", server.Authorize("ci@example.com").AccessToken)
+	t.Setenv("CLI_DO_EMAIL", "ci@example.com")
+
+	if _, err := run(t, "-p", project.Id, "todo", "new", "--subject", "Deploy"); err != nil {
+		t.Fatalf("todo new: %v", err)
+	}
+
+	if _, err := run(t, "-p", project.Id, "todo", "complete", "1"); err != nil {
+		t.Fatalf("todo complete: %v", err)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); !todo.Completed {
+		t.Fatal("expected todo to be completed")
+	}
+
+	t.Setenv("CLI_DO_TOKEN", "revoked")
+
+	if _, err := run(t, "project", "list"); ExitCode(err) != ExitAuth {
+		t.Fatalf("got %v, want an auth error", err)
+	}
+}
+
+func TestHandleLoginDevice(t *testing.T) {
+	var server = setup(t)
+
+	if err := DeleteAuth(DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			if codes := server.PendingUserCodes(); len(codes) > 0 {
+				_ = server.ApproveDevice(codes[0], "sso@example.com")
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	if _, err := run(t, "login", "--device"); err != nil {
+		t.Fatalf("login --device: %v", err)
+	}
+
+	auth, err := GetAuth(DefaultProfile)
+
+	if err != nil || auth.Email != "sso@example.com" {
+		t.Fatalf("unexpected auth %+v, %v", auth, err)
+	}
+}
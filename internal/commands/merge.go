@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// MergeTodos combines the changes theirs and mine each made to base, on top
+// of theirs' version. A field both changed differently is a conflict: it
+// keeps mine, except the body, which gets both versions between conflict
+// markers.
+func MergeTodos(base clido.Todo, theirs clido.Todo, mine clido.Todo) (clido.Todo, []string) {
+	var merged = theirs
+	var conflicts []string
+
+	if useMine, conflict := mergeField(base.Subject, theirs.Subject, mine.Subject); useMine {
+		merged.Subject = mine.Subject
+
+		if conflict {
+			conflicts = append(conflicts, "subject")
+		}
+	}
+
+	if useMine, conflict := mergeField(formatDueDate(base.DueDate), formatDueDate(theirs.DueDate), formatDueDate(mine.DueDate)); useMine {
+		merged.DueDate = mine.DueDate
+
+		if conflict {
+			conflicts = append(conflicts, "due date")
+		}
+	}
+
+	if useMine, conflict := mergeField(strconv.FormatBool(base.Completed), strconv.FormatBool(theirs.Completed), strconv.FormatBool(mine.Completed)); useMine {
+		merged.Completed = mine.Completed
+
+		if conflict {
+			conflicts = append(conflicts, "completed")
+		}
+	}
+
+	if useMine, conflict := mergeField(base.Body, theirs.Body, mine.Body); useMine {
+		merged.Body = mine.Body
+
+		if conflict {
+			merged.Body = fmt.Sprintf("<<<<<<< mine\n%s\n||||||| base\n%s\n=======\n%s\n>>>>>>> theirs\n",
+				strings.TrimRight(mine.Body, "\n"),
+				strings.TrimRight(base.Body, "\n"),
+				strings.TrimRight(theirs.Body, "\n"))
+			conflicts = append(conflicts, "body")
+		}
+	}
+
+	return merged, conflicts
+}
+
+// mergeField reports whether the merge takes mine's value, and whether that
+// overrides a different change in theirs.
+func mergeField(base string, theirs string, mine string) (bool, bool) {
+	switch {
+	case mine == base:
+		return false, false
+	case theirs == base || theirs == mine:
+		return true, false
+	}
+
+	return true, true
+}
+
+// PrintTodoConflict shows the fields that differ between base, theirs and
+// mine, and what each side changed in the body.
+func PrintTodoConflict(w io.Writer, base clido.Todo, theirs clido.Todo, mine clido.Todo) {
+	var tbl = table.New("Field", "Base", "Theirs", "Mine").WithWriter(w)
+	var rows = [][]string{
+		{"Subject", base.Subject, theirs.Subject, mine.Subject},
+		{"Due date", formatDueDate(base.DueDate), formatDueDate(theirs.DueDate), formatDueDate(mine.DueDate)},
+		{"Completed", strconv.FormatBool(base.Completed), strconv.FormatBool(theirs.Completed), strconv.FormatBool(mine.Completed)},
+	}
+
+	for _, row := range rows {
+		if row[1] != row[2] || row[1] != row[3] {
+			tbl.AddRow(row[0], row[1], row[2], row[3])
+		}
+	}
+
+	tbl.Print()
+
+	if theirs.Body != base.Body {
+		fmt.Fprintln(w, "\nTheir changes to the body:")
+		printLineDiff(w, base.Body, theirs.Body)
+	}
+
+	if mine.Body != base.Body {
+		fmt.Fprintln(w, "\nYour changes to the body:")
+		printLineDiff(w, base.Body, mine.Body)
+	}
+}
+
+// printLineDiff prints b against a line by line, marking removed lines with
+// - and added ones with +.
+func printLineDiff(w io.Writer, a string, b string) {
+	var before = strings.Split(strings.TrimRight(a, "\n"), "\n")
+	var after = strings.Split(strings.TrimRight(b, "\n"), "\n")
+
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:].
+	var common = make([][]int, len(before)+1)
+
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var i, j = 0, 0
+
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			fmt.Fprintf(w, "  %s\n", before[i])
+			i++
+			j++
+		case j < len(after) && (i == len(before) || common[i][j+1] >= common[i+1][j]):
+			fmt.Fprintf(w, "+ %s\n", after[j])
+			j++
+		default:
+			fmt.Fprintf(w, "- %s\n", before[i])
+			i++
+		}
+	}
+}
+
+// resolveEditConflict is called when an edit based on base was refused
+// because the server now has theirs. It shows the differences and asks
+// whether to merge, edit again, keep mine or abort, and returns the todo to
+// send next, based on theirs' version.
+func resolveEditConflict(ctx *cli.Context, reader *bufio.Reader, path string, conflictErr error, base clido.Todo, theirs clido.Todo, mine clido.Todo) (clido.Todo, error) {
+	var w = ctx.App.Writer
+	var merged, conflicts = MergeTodos(base, theirs, mine)
+	mine.ETag = theirs.ETag
+
+	fmt.Fprintln(w, "The todo changed on the server while you were editing it.")
+	PrintTodoConflict(w, base, theirs, mine)
+
+	if len(conflicts) == 0 {
+		fmt.Fprintln(w, "\nYour changes and theirs do not overlap and can be merged.")
+	} else {
+		fmt.Fprintf(w, "\nBoth sides changed the %s.\n", strings.Join(conflicts, ", "))
+	}
+
+	for {
+		fmt.Fprint(w, "[m]erge, [e]dit again, [k]eep mine or [a]bort? ")
+		answer, err := readLine(reader)
+
+		if err != nil {
+			return mine, fmt.Errorf("edit aborted: %w", conflictErr)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "m", "merge":
+			if len(conflicts) == 0 {
+				return merged, nil
+			}
+
+			return EditTodoFile(merged, path)
+		case "e", "edit":
+			return EditTodoFile(mine, path)
+		case "k", "keep":
+			return mine, nil
+		case "a", "abort":
+			return mine, fmt.Errorf("edit aborted: %w", conflictErr)
+		}
+	}
+}
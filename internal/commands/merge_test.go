@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func TestMergeTodos(t *testing.T) {
+	var base = clido.Todo{Subject: "Buy milk", Body: "Oat"}
+
+	var cases = []struct {
+		name      string
+		theirs    clido.Todo
+		mine      clido.Todo
+		want      clido.Todo
+		conflicts []string
+	}{
+		{
+			name:   "separate fields",
+			theirs: clido.Todo{Subject: "Buy milk", Body: "Oat, two cartons"},
+			mine:   clido.Todo{Subject: "Buy oat milk", Body: "Oat"},
+			want:   clido.Todo{Subject: "Buy oat milk", Body: "Oat, two cartons"},
+		},
+		{
+			name:   "same change",
+			theirs: clido.Todo{Subject: "Buy bread", Body: "Oat"},
+			mine:   clido.Todo{Subject: "Buy bread", Body: "Oat"},
+			want:   clido.Todo{Subject: "Buy bread", Body: "Oat"},
+		},
+		{
+			name:      "subject conflict",
+			theirs:    clido.Todo{Subject: "Buy bread", Body: "Oat"},
+			mine:      clido.Todo{Subject: "Buy eggs", Body: "Oat"},
+			want:      clido.Todo{Subject: "Buy eggs", Body: "Oat"},
+			conflicts: []string{"subject"},
+		},
+		{
+			name:      "body conflict",
+			theirs:    clido.Todo{Subject: "Buy milk", Body: "Soy"},
+			mine:      clido.Todo{Subject: "Buy milk", Body: "Rye"},
+			want:      clido.Todo{Subject: "Buy milk", Body: "<<<<<<< mine\nRye\n||||||| base\nOat\n=======\nSoy\n>>>>>>> theirs\n"},
+			conflicts: []string{"body"},
+		},
+	}
+
+	for _, c := range cases {
+		merged, conflicts := MergeTodos(base, c.theirs, c.mine)
+
+		if merged.Subject != c.want.Subject || merged.Body != c.want.Body {
+			t.Errorf("%s: got %+v, want %+v", c.name, merged, c.want)
+		}
+
+		if strings.Join(conflicts, ",") != strings.Join(c.conflicts, ",") {
+			t.Errorf("%s: got conflicts %v, want %v", c.name, conflicts, c.conflicts)
+		}
+	}
+}
+
+// editConcurrently sets an editor that applies script to the todo file, and
+// runs change against the server while it has the file open.
+func editConcurrently(t *testing.T, script string, change func()) {
+	t.Helper()
+
+	var dir = t.TempDir()
+	var editor = filepath.Join(dir, "editor.sh")
+	var started = filepath.Join(dir, "started")
+	var resume = filepath.Join(dir, "resume")
+
+	script = "#!/bin/sh\ntouch " + started + "\nwhile [ ! -f " + resume + " ]; do sleep 0.01; done\n" + script
+
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("EDITOR", editor)
+
+	go func() {
+		for {
+			if _, err := os.Stat(started); err == nil {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		change()
+		_ = os.WriteFile(resume, nil, 0644)
+	}()
+}
+
+func TestHandleEditTodoConflict(t *testing.T) {
+	var cases = []struct {
+		input   string
+		subject string
+		body    string
+	}{
+		{input: "m\n", subject: "Buy bread", body: "Oat, two cartons"},
+		{input: "x\nk\n", subject: "Buy bread", body: "Oat"},
+	}
+
+	for _, c := range cases {
+		var server = setup(t)
+		var project = server.AddProject("Inbox", "")
+		_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk", Body: "Oat"})
+
+		editConcurrently(t, "sed -i 's/subject: Buy milk/subject: Buy bread/' \"$1\"\n", func() {
+			_ = server.EditTodo(project.Id, 1, func(todo *clidotest.Todo) { todo.Body = "Oat, two cartons" })
+		})
+
+		out, err := runWithInput(t, c.input, "-p", project.Id, "todo", "edit", "1")
+
+		if err != nil {
+			t.Fatalf("%q: todo edit: %v", c.input, err)
+		}
+
+		if !strings.Contains(out, "changed on the server while you were editing") || !strings.Contains(out, "+ Oat, two cartons") {
+			t.Fatalf("%q: expected the differences in %q", c.input, out)
+		}
+
+		if todo, _ := server.Todo(project.Id, 1); todo.Subject != c.subject || todo.Body != c.body {
+			t.Fatalf("%q: unexpected todo %+v", c.input, todo)
+		}
+	}
+}
+
+func TestHandleEditTodoConflictAbort(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	editConcurrently(t, "sed -i 's/subject: Buy milk/subject: Buy bread/' \"$1\"\n", func() {
+		_ = server.EditTodo(project.Id, 1, func(todo *clidotest.Todo) { todo.Subject = "Buy eggs" })
+	})
+
+	out, err := runWithInput(t, "a\n", "-p", project.Id, "todo", "edit", "1")
+
+	if !errors.Is(err, clido.ErrConflict) {
+		t.Fatalf("got %v, want clido.ErrConflict", err)
+	}
+
+	if !strings.Contains(out, "Both sides changed the subject.") {
+		t.Fatalf("expected the conflicting field in %q", out)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); todo.Subject != "Buy eggs" {
+		t.Fatalf("expected the other change to be kept, got %+v", todo)
+	}
+
+	if leftovers := todoFiles(); len(leftovers) != 1 {
+		t.Fatalf("expected the edited file to be kept, found %v", leftovers)
+	}
+}
+
+func TestHandleEditTodoStartsFromServerCopy(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+	t.Setenv("CLI_DO_CACHE_TTL", "1h")
+
+	if _, err := run(t, "-p", project.Id, "todo", "get", "1"); err != nil {
+		t.Fatalf("todo get: %v", err)
+	}
+
+	// The cached copy is still fresh, but the edit must not start from it.
+	_ = server.EditTodo(project.Id, 1, func(todo *clidotest.Todo) { todo.Subject = "Buy oat milk" })
+
+	var editor = filepath.Join(t.TempDir(), "editor.sh")
+
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\ngrep -q 'subject: Buy oat milk' \"$1\" && echo 'Two cartons' >> \"$1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("EDITOR", editor)
+
+	if out, err := run(t, "-p", project.Id, "todo", "edit", "1"); err != nil || strings.Contains(out, "changed on the server") {
+		t.Fatalf("todo edit: %q, %v", out, err)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); todo.Subject != "Buy oat milk" || todo.Body != "Two cartons" {
+		t.Fatalf("unexpected todo %+v", todo)
+	}
+}
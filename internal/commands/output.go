@@ -0,0 +1,208 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OutputTable    = "table"
+	OutputJson     = "json"
+	OutputJsonl    = "jsonl"
+	OutputYaml     = "yaml"
+	OutputCsv      = "csv"
+	OutputTsv      = "tsv"
+	OutputTemplate = "template"
+)
+
+// Output describes one result in every supported format. Value is what json
+// and yaml marshal, Items are the rows written by jsonl, csv, tsv and
+// template, and Table prints the human readable default.
+type Output struct {
+	Value   interface{}
+	Items   []interface{}
+	Columns []string
+	Record  func(item interface{}) []string
+	Table   func(w io.Writer)
+}
+
+func OutputFormat(ctx *cli.Context) (string, error) {
+	format, tmpl := outputFlags(ctx)
+
+	if tmpl != "" {
+		return OutputTemplate, nil
+	}
+
+	switch format {
+	case "":
+		return OutputTable, nil
+	case OutputTable, OutputJson, OutputJsonl, OutputYaml, OutputCsv, OutputTsv:
+		return format, nil
+	case OutputTemplate:
+		return "", NewUsageError("The template output requires --format.")
+	}
+
+	return "", NewUsageError("Unknown output format %q. Use table, json, jsonl, yaml, csv, tsv or template.", format)
+}
+
+// outputFlags returns --output and --format, or the defaults of the project
+// file when neither flag was given.
+func outputFlags(ctx *cli.Context) (string, string) {
+	var output, format = ctx.String("output"), ctx.String("format")
+
+	if isGlobalFlagSet(ctx, "output") || isGlobalFlagSet(ctx, "format") {
+		return output, format
+	}
+
+	directorySettings, err := LoadDirectorySettings()
+
+	if err != nil {
+		return output, format
+	}
+
+	if directorySettings.Output != "" {
+		output = directorySettings.Output
+	}
+
+	return output, directorySettings.Format
+}
+
+func (output Output) Render(ctx *cli.Context) error {
+	format, err := OutputFormat(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var w = ctx.App.Writer
+
+	switch format {
+	case OutputJson:
+		var encoder = json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(output.Value)
+	case OutputJsonl:
+		var encoder = json.NewEncoder(w)
+
+		for _, item := range output.Items {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case OutputYaml:
+		var encoder = yaml.NewEncoder(w)
+		defer encoder.Close()
+
+		return encoder.Encode(output.Value)
+	case OutputTsv:
+		writeTsvRow(w, output.Columns)
+
+		for _, item := range output.Items {
+			writeTsvRow(w, output.Record(item))
+		}
+
+		return nil
+	case OutputCsv:
+		var writer = csv.NewWriter(w)
+
+		_ = writer.Write(output.Columns)
+
+		for _, item := range output.Items {
+			_ = writer.Write(output.Record(item))
+		}
+
+		writer.Flush()
+
+		return writer.Error()
+	case OutputTemplate:
+		_, format := outputFlags(ctx)
+		tmpl, err := template.New("format").Parse(format)
+
+		if err != nil {
+			return NewUsageError("Invalid --format template: %s", err)
+		}
+
+		for _, item := range output.Items {
+			if err := tmpl.Execute(w, item); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(w)
+		}
+
+		return nil
+	}
+
+	output.Table(w)
+
+	if notice := cacheNotice(ctx); notice != "" {
+		fmt.Fprintf(w, "\n%s\n", notice)
+	}
+
+	return nil
+}
+
+// tsvEscaper escapes the characters that would otherwise end a TSV field or
+// row, the way PostgreSQL's text format does, so each todo stays on one line
+// for cut and awk.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func writeTsvRow(w io.Writer, fields []string) {
+	var escaped = make([]string, len(fields))
+
+	for i, field := range fields {
+		escaped[i] = tsvEscaper.Replace(field)
+	}
+
+	fmt.Fprintln(w, strings.Join(escaped, "\t"))
+}
+
+func TodoColumns() []string {
+	return []string{"ticket", "subject", "body", "due_date", "completed", "past_due"}
+}
+
+func TodoRecord(item interface{}) []string {
+	var todo = item.(clido.Todo)
+	var dueDate string
+
+	if todo.DueDate != nil {
+		dueDate = todo.DueDate.Format("2006-01-02")
+	}
+
+	return []string{
+		strconv.Itoa(todo.Ticket),
+		todo.Subject,
+		todo.Body,
+		dueDate,
+		strconv.FormatBool(todo.Completed),
+		strconv.FormatBool(todo.PastDue),
+	}
+}
+
+func ProjectColumns() []string {
+	return []string{"ticket", "id", "key", "name", "description"}
+}
+
+func ProjectRecord(item interface{}) []string {
+	var project = item.(clido.Project)
+
+	return []string{
+		strconv.Itoa(project.Ticket),
+		project.Id,
+		project.Key,
+		project.Name,
+		project.Description,
+	}
+}
@@ -0,0 +1,388 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// The default profile lives directly in the config directory so installs
+// from before profiles existed keep working. Named profiles each get their
+// own directory under profiles/.
+const DefaultProfile = "default"
+
+var profileNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type Profile struct {
+	Name     string `json:"name" yaml:"name"`
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	ClientId string `json:"client_id" yaml:"client_id"`
+	Active   bool   `json:"active" yaml:"active"`
+}
+
+func ProfileDir(profile string) (string, error) {
+	dir, err := ConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	if profile == "" || profile == DefaultProfile {
+		return dir, nil
+	}
+
+	return filepath.Join(dir, "profiles", profile), nil
+}
+
+// ActiveProfile resolves the profile for this invocation: the --profile flag
+// or CLI_DO_PROFILE, then the project file, then the one selected with
+// 'profile use', then default.
+func ActiveProfile(ctx *cli.Context) (string, error) {
+	var profile = ctx.String("profile")
+
+	if profile == "" {
+		directorySettings, err := LoadDirectorySettings()
+
+		if err != nil {
+			return "", err
+		}
+
+		profile = directorySettings.Profile
+	}
+
+	if profile == "" {
+		profile = ReadActiveProfileFile()
+	}
+
+	if profile == "" {
+		return DefaultProfile, nil
+	}
+
+	if !ProfileExists(profile) {
+		return "", NewUsageError("Profile %q does not exist. Run 'cli-do profile add %s' to create it.", profile, profile)
+	}
+
+	return profile, nil
+}
+
+func ReadActiveProfileFile() string {
+	dir, err := ConfigDir()
+
+	if err != nil {
+		return ""
+	}
+
+	byteValue, _ := os.ReadFile(filepath.Join(dir, "profile"))
+
+	return strings.TrimSpace(string(byteValue))
+}
+
+func ProfileExists(profile string) bool {
+	if profile == DefaultProfile {
+		return true
+	}
+
+	if !profileNameRegex.MatchString(profile) {
+		return false
+	}
+
+	dir, err := ProfileDir(profile)
+
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(dir)
+
+	return err == nil && info.IsDir()
+}
+
+func GetProfiles() ([]Profile, error) {
+	dir, err := ConfigDir()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var names = []string{DefaultProfile}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "profiles"))
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != DefaultProfile && profileNameRegex.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+
+	var active = ReadActiveProfileFile()
+
+	if active == "" || !ProfileExists(active) {
+		active = DefaultProfile
+	}
+
+	var profiles []Profile
+
+	for _, name := range names {
+		config, _, err := LoadConfig(nil, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		profiles = append(profiles, Profile{
+			Name:     name,
+			Endpoint: config.Endpoint,
+			ClientId: config.ClientId,
+			Active:   name == active,
+		})
+	}
+
+	return profiles, nil
+}
+
+func HandleProfileAdd(ctx *cli.Context) error {
+	var name = ctx.Args().First()
+
+	if name == "" {
+		return NewUsageError("A profile name is required.")
+	}
+
+	if !profileNameRegex.MatchString(name) {
+		return NewUsageError("Profile names may only contain letters, numbers, '-' and '_'.")
+	}
+
+	if ctx.String("endpoint") == "" {
+		return NewUsageError("An endpoint is required.")
+	}
+
+	if err := ValidateConfig(clido.Config{Endpoint: ctx.String("endpoint")}); err != nil {
+		return err
+	}
+
+	if name == DefaultProfile || ProfileExists(name) {
+		return NewUsageError("Profile %q already exists.", name)
+	}
+
+	dir, err := ProfileDir(name)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	bytes, err := json.MarshalIndent(map[string]string{
+		"endpoint":  ctx.String("endpoint"),
+		"client_id": ctx.String("client-id"),
+	}, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "config.json"), bytes, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "Profile %s added. Run 'cli-do --profile %s login' to log in.\n", name, name)
+
+	return nil
+}
+
+func HandleProfileList(ctx *cli.Context) error {
+	profiles, err := GetProfiles()
+
+	if err != nil {
+		return err
+	}
+
+	return ProfilesOutput(profiles).Render(ctx)
+}
+
+func ProfilesOutput(profiles []Profile) Output {
+	var items = make([]interface{}, 0, len(profiles))
+
+	for _, profile := range profiles {
+		items = append(items, profile)
+	}
+
+	return Output{
+		Value:   profiles,
+		Items:   items,
+		Columns: []string{"name", "endpoint", "client_id", "active"},
+		Record: func(item interface{}) []string {
+			var profile = item.(Profile)
+
+			return []string{profile.Name, profile.Endpoint, profile.ClientId, strconv.FormatBool(profile.Active)}
+		},
+		Table: func(w io.Writer) {
+			PrintProfilesTable(w, profiles)
+		},
+	}
+}
+
+func PrintProfilesTable(w io.Writer, profiles []Profile) {
+	var tbl = table.New("", "Name", "Endpoint").WithWriter(w)
+
+	for _, profile := range profiles {
+		var marker = ""
+
+		if profile.Active {
+			marker = "*"
+		}
+
+		tbl.AddRow(marker, profile.Name, profile.Endpoint)
+	}
+
+	tbl.Print()
+}
+
+func HandleProfileUse(ctx *cli.Context) error {
+	var name = ctx.Args().First()
+
+	if name == "" {
+		return NewUsageError("A profile name is required.")
+	}
+
+	if !ProfileExists(name) {
+		return NewUsageError("Profile %q does not exist.", name)
+	}
+
+	err := writeActiveProfileFile(name)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "Now using profile %s.\n", name)
+
+	return nil
+}
+
+func HandleProfileRemove(ctx *cli.Context) error {
+	var name = ctx.Args().First()
+
+	if name == "" {
+		return NewUsageError("A profile name is required.")
+	}
+
+	if name == DefaultProfile {
+		return NewUsageError("The default profile cannot be removed.")
+	}
+
+	if !ProfileExists(name) {
+		return NewUsageError("Profile %q does not exist.", name)
+	}
+
+	if err := requireSyncedQueue(ctx, name); err != nil {
+		return err
+	}
+
+	if err := DeleteAuth(name); err != nil {
+		return err
+	}
+
+	if _, err := forgetAccountData(name); err != nil {
+		return err
+	}
+
+	dir, err := ProfileDir(name)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	if ReadActiveProfileFile() == name {
+		if err := writeActiveProfileFile(DefaultProfile); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "Profile %s removed.\n", name)
+
+	return nil
+}
+
+type Identity struct {
+	Profile  string `json:"profile" yaml:"profile"`
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	Email    string `json:"email" yaml:"email"`
+}
+
+func HandleWhoami(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	config, _, err := LoadConfig(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	auth, err := GetAuth(profile)
+
+	if err != nil {
+		return err
+	}
+
+	var identity = Identity{
+		Profile:  profile,
+		Endpoint: config.Endpoint,
+		Email:    auth.Email,
+	}
+
+	return Output{
+		Value:   identity,
+		Items:   []interface{}{identity},
+		Columns: []string{"profile", "endpoint", "email"},
+		Record: func(item interface{}) []string {
+			var identity = item.(Identity)
+
+			return []string{identity.Profile, identity.Endpoint, identity.Email}
+		},
+		Table: func(w io.Writer) {
+			fmt.Fprintln(w, "Profile:", identity.Profile)
+			fmt.Fprintln(w, "Endpoint:", identity.Endpoint)
+			fmt.Fprintln(w, "Email:", identity.Email)
+		},
+	}.Render(ctx)
+}
+
+func writeActiveProfileFile(profile string) error {
+	dir, err := ConfigDir()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "profile"), []byte(profile+"\n"), 0644)
+}
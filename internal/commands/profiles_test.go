@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func TestProfiles(t *testing.T) {
+	setup(t)
+
+	var work = clidotest.NewServer()
+	t.Cleanup(work.Close)
+	work.AddProject("Work inbox", "")
+
+	if _, err := run(t, "profile", "add", "--endpoint", work.URL, "work"); err != nil {
+		t.Fatalf("profile add: %v", err)
+	}
+
+	if _, err := run(t, "profile", "add", "--endpoint", work.URL, "work"); ExitCode(err) != ExitUsage {
+		t.Fatalf("adding a duplicate profile: got %v, want a usage error", err)
+	}
+
+	if _, err := run(t, "--profile", "work", "project", "list"); ExitCode(err) != ExitAuth {
+		t.Fatalf("listing without credentials: got %v, want an auth error", err)
+	}
+
+	if err := SaveAuth("work", clido.Auth(work.Authorize("reed@work.example.com"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "profile", "use", "work"); err != nil {
+		t.Fatalf("profile use: %v", err)
+	}
+
+	out, err := run(t, "-o", "json", "project", "list")
+
+	if err != nil || !strings.Contains(out, "Work inbox") {
+		t.Fatalf("project list on work profile: %q, %v", out, err)
+	}
+
+	out, err = run(t, "-o", "json", "whoami")
+
+	if err != nil {
+		t.Fatalf("whoami: %v", err)
+	}
+
+	var identity Identity
+
+	if err := json.Unmarshal([]byte(out), &identity); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+
+	if identity.Profile != "work" || identity.Email != "reed@work.example.com" || identity.Endpoint != work.URL {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	t.Setenv("CLI_DO_PROFILE", DefaultProfile)
+
+	out, err = run(t, "-o", "json", "whoami")
+
+	if err != nil || !strings.Contains(out, `"profile": "default"`) {
+		t.Fatalf("whoami with CLI_DO_PROFILE: %q, %v", out, err)
+	}
+
+	t.Setenv("CLI_DO_PROFILE", "")
+
+	if _, err := run(t, "--profile", "work", "--offline", "project", "new", "--name", "Later"); err != nil {
+		t.Fatalf("queuing a project: %v", err)
+	}
+
+	if _, err := run(t, "profile", "remove", "work"); ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "cli-do sync") {
+		t.Fatalf("removing a profile with queued changes: got %v, want a usage error", err)
+	}
+
+	if _, err := run(t, "profile", "remove", "--force", "work"); err != nil {
+		t.Fatalf("profile remove: %v", err)
+	}
+
+	profiles, err := GetProfiles()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(profiles) != 1 || profiles[0].Name != DefaultProfile || !profiles[0].Active {
+		t.Fatalf("unexpected profiles after removal %+v", profiles)
+	}
+
+	var dir, _ = CacheDir("work")
+
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the cache of the removed profile to be deleted, got %v", err)
+	}
+}
+
+func TestUnknownProfile(t *testing.T) {
+	setup(t)
+
+	if _, err := run(t, "--profile", "missing", "project", "list"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got %v, want a usage error", err)
+	}
+}
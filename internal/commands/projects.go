@@ -0,0 +1,359 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ResolveProjectId turns a project reference into its Id. UUIDs and the
+// provisional Ids of projects created offline are taken as is, without a
+// request; anything else is matched by ResolveProject.
+func ResolveProjectId(ctx context.Context, api clido.Api, ref string) (string, error) {
+	if uuidRegex.MatchString(ref) || provisionalProjectRegex.MatchString(ref) {
+		return ref, nil
+	}
+
+	project, err := ResolveProject(ctx, api, ref)
+
+	if err != nil {
+		return "", err
+	}
+
+	return project.Id, nil
+}
+
+// ResolveProject finds the project ref names, trying in order its Id, its
+// key, its ticket number, its exact name, its name ignoring case and finally an
+// unambiguous prefix of its name.
+func ResolveProject(ctx context.Context, api clido.Api, ref string) (clido.Project, error) {
+	if ref == "" {
+		return clido.Project{}, NewUsageError("A project is required.")
+	}
+
+	if uuidRegex.MatchString(ref) {
+		return api.GetProject(ctx, ref)
+	}
+
+	projects, err := api.GetProjects(ctx)
+
+	if err != nil {
+		return clido.Project{}, err
+	}
+
+	var ticket, ticketErr = strconv.Atoi(ref)
+
+	var matchers = []func(project clido.Project) bool{
+		func(project clido.Project) bool { return project.Id == ref },
+		func(project clido.Project) bool { return project.Key != "" && strings.EqualFold(project.Key, ref) },
+		func(project clido.Project) bool { return ticketErr == nil && project.Ticket == ticket },
+		func(project clido.Project) bool { return project.Name == ref },
+		func(project clido.Project) bool { return strings.EqualFold(project.Name, ref) },
+		func(project clido.Project) bool {
+			return strings.HasPrefix(strings.ToLower(project.Name), strings.ToLower(ref))
+		},
+	}
+
+	for _, matches := range matchers {
+		var found []clido.Project
+
+		for _, project := range projects.Projects {
+			if matches(project) {
+				found = append(found, project)
+			}
+		}
+
+		if len(found) == 1 {
+			return found[0], nil
+		}
+
+		if len(found) > 1 {
+			var candidates []string
+
+			for _, project := range found {
+				candidates = append(candidates, fmt.Sprintf("  %d  %s", project.Ticket, project.Name))
+			}
+
+			return clido.Project{}, NewUsageError("Project %q is ambiguous, it matches:\n%s\nUse the ticket number or the full name.", ref, strings.Join(candidates, "\n"))
+		}
+	}
+
+	return clido.Project{}, NewNotFoundError("No project matches %q. Run 'cli-do project list' to see your projects.", ref)
+}
+
+// ResolveProjectKey returns the Id of the project with key, from the key
+// cache of the active profile when possible. A miss refreshes the cache from
+// GetProjects; so does refreshTodoRef when a cached key turns out stale.
+func ResolveProjectKey(ctx *cli.Context, api clido.Api, key string) (string, error) {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	key = strings.ToUpper(key)
+
+	if projectId, ok := readProjectKeys(profile)[key]; ok {
+		return projectId, nil
+	}
+
+	projects, err := api.GetProjects(ctx.Context)
+
+	if err != nil {
+		return "", err
+	}
+
+	var keys = cacheProjectKeys(profile, projects.Projects)
+
+	if projectId, ok := keys[key]; ok {
+		return projectId, nil
+	}
+
+	return "", NewNotFoundError("No project has the key %s. Run 'cli-do project list' to see your projects.", key)
+}
+
+func projectKeysPath(profile string) (string, error) {
+	dir, err := ProfileDir(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "project-keys.json"), nil
+}
+
+// readProjectKeys returns the cached key to Id map, empty when there is no
+// usable cache.
+func readProjectKeys(profile string) map[string]string {
+	var keys = map[string]string{}
+
+	path, err := projectKeysPath(profile)
+
+	if err != nil {
+		return keys
+	}
+
+	byteValue, err := os.ReadFile(path)
+
+	if err != nil {
+		return keys
+	}
+
+	_ = json.Unmarshal(byteValue, &keys)
+
+	return keys
+}
+
+// cacheProjectKeys replaces the key cache with the keys of projects. The
+// cache only saves a request, so failing to write it is not an error.
+func cacheProjectKeys(profile string, projects []clido.Project) map[string]string {
+	var keys = map[string]string{}
+
+	for _, project := range projects {
+		if project.Key != "" {
+			keys[strings.ToUpper(project.Key)] = project.Id
+		}
+	}
+
+	path, err := projectKeysPath(profile)
+
+	if err != nil {
+		return keys
+	}
+
+	if bytes, err := json.Marshal(keys); err == nil && os.MkdirAll(filepath.Dir(path), 0700) == nil {
+		_ = writeFileAtomic(path, bytes, 0600)
+	}
+
+	return keys
+}
+
+func HandleProjectList(ctx *cli.Context) error {
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projects, err := api.GetProjects(ctx.Context)
+
+	if err != nil {
+		return err
+	}
+
+	if profile, err := ActiveProfile(ctx); err == nil {
+		cacheProjectKeys(profile, projects.Projects)
+	}
+
+	return ProjectsOutput(projects.Projects).Render(ctx)
+}
+
+func ProjectsOutput(projects []clido.Project) Output {
+	var items = make([]interface{}, 0, len(projects))
+
+	for _, project := range projects {
+		items = append(items, project)
+	}
+
+	if projects == nil {
+		projects = []clido.Project{}
+	}
+
+	return Output{
+		Value:   projects,
+		Items:   items,
+		Columns: ProjectColumns(),
+		Record:  ProjectRecord,
+		Table: func(w io.Writer) {
+			PrintProjectsTable(w, projects)
+		},
+	}
+}
+
+func PrintProjectsTable(w io.Writer, projects []clido.Project) {
+	var tbl = table.New("ID", "Key", "Name").WithWriter(w)
+
+	for _, project := range projects {
+		tbl.AddRow(project.Ticket, project.Key, project.Name)
+	}
+
+	tbl.Print()
+}
+
+func HandleInitProjectDirectory(ctx *cli.Context) error {
+	if ctx.Args().First() == "" {
+		return NewUsageError("A project is required: its ID, ticket number or name.")
+	}
+
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		return err
+	}
+
+	var path = filepath.Join(wd, ProjectSettingsFile)
+
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintln(ctx.App.Writer, "Project directory already initialized!")
+		return nil
+	}
+
+	project, err := ResolveProject(ctx.Context, api, ctx.Args().First())
+
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path, []byte(fmt.Sprintf(`{"project_id": "%s"}`, project.Id)), 0644)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Project directory initialized successfully!")
+
+	return nil
+}
+
+func HandleProjectNew(ctx *cli.Context) error {
+	if ctx.String("name") == "" {
+		return NewUsageError("A project name is required.")
+	}
+
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var key = strings.ToUpper(ctx.String("key"))
+
+	if key == "" {
+		key = deriveProjectKey(ctx, api, ctx.String("name"))
+	}
+
+	var createProject = clido.CreateProject{
+		Project: clido.Project{
+			Name:        ctx.String("name"),
+			Key:         key,
+			Description: ctx.String("description"),
+		},
+	}
+
+	_, err = api.CreateProject(ctx.Context, createProject)
+
+	if reportQueued(ctx.App.Writer, err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Project created successfully!")
+
+	return nil
+}
+
+// deriveProjectKey derives a key for a new project called name that no
+// existing project uses. When the projects cannot be listed, such as offline,
+// the server is left to reject a key that turns out to be taken.
+func deriveProjectKey(ctx *cli.Context, api clido.Api, name string) string {
+	var taken = map[string]bool{}
+
+	if projects, err := api.GetProjects(ctx.Context); err == nil {
+		for _, project := range projects.Projects {
+			taken[strings.ToUpper(project.Key)] = true
+		}
+	}
+
+	return clido.DeriveProjectKey(name, func(key string) bool {
+		return taken[key]
+	})
+}
+
+func HandleProjectArchive(ctx *cli.Context) error {
+	if ctx.Args().First() == "" {
+		return NewUsageError("A project is required: its ID, ticket number or name.")
+	}
+
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projectId, err := ResolveProjectId(ctx.Context, api, ctx.Args().First())
+
+	if err != nil {
+		return err
+	}
+
+	err = api.ArchiveProject(ctx.Context, projectId)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Project archived successfully!")
+
+	return nil
+}
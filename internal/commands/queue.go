@@ -0,0 +1,331 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// Kinds of change that can be queued while offline.
+const (
+	ChangeCreateProject = "create_project"
+	ChangeCreateTodo    = "create_todo"
+	ChangeUpdateTodo    = "update_todo"
+	ChangeCompleteTodo  = "complete_todo"
+	ChangeArchiveTodo   = "archive_todo"
+)
+
+// Todos and projects created offline get provisional references, L3 and
+// local-3, until 'cli-do sync' sends them and learns the real ones.
+var (
+	provisionalTicketRegex  = regexp.MustCompile(`^L[0-9]+$`)
+	provisionalProjectRegex = regexp.MustCompile(`^local-[0-9]+$`)
+)
+
+// QueuedChange is a change made while the server could not be used. Base is
+// the todo it changes as the cache and the changes queued before it left it,
+// used by sync to notice that the server copy changed in the meantime.
+// BaseETag is the ETag of the server copy an edit was made against, when
+// known, and is sent with it so the server refuses it if that copy changed.
+type QueuedChange struct {
+	Id            int                  `json:"id" yaml:"id"`
+	Kind          string               `json:"kind" yaml:"kind"`
+	ProjectId     string               `json:"project_id,omitempty" yaml:"project_id,omitempty"`
+	Ticket        string               `json:"ticket,omitempty" yaml:"ticket,omitempty"`
+	QueuedAt      time.Time            `json:"queued_at" yaml:"queued_at"`
+	CreateProject *clido.CreateProject `json:"create_project,omitempty" yaml:"create_project,omitempty"`
+	CreateTodo    *clido.CreateTodo    `json:"create_todo,omitempty" yaml:"create_todo,omitempty"`
+	UpdateTodo    *clido.UpdateTodo    `json:"update_todo,omitempty" yaml:"update_todo,omitempty"`
+	Base          *clido.Todo          `json:"base,omitempty" yaml:"base,omitempty"`
+	BaseETag      string               `json:"base_etag,omitempty" yaml:"base_etag,omitempty"`
+}
+
+// Summary is a short description of the change for listings.
+func (change QueuedChange) Summary() string {
+	switch {
+	case change.CreateProject != nil:
+		return change.CreateProject.Project.Name
+	case change.CreateTodo != nil:
+		return change.CreateTodo.Todo.Subject
+	case change.UpdateTodo != nil:
+		return change.UpdateTodo.Todo.Subject
+	case change.Base != nil:
+		return change.Base.Subject
+	}
+
+	return ""
+}
+
+type changeQueue struct {
+	Next    int            `json:"next"`
+	Changes []QueuedChange `json:"changes"`
+}
+
+// QueuedError is returned for a change that was queued instead of sent.
+// Handlers report it with reportQueued rather than as a failure.
+type QueuedError struct {
+	Change QueuedChange
+}
+
+func (e *QueuedError) Error() string {
+	switch e.Change.Kind {
+	case ChangeCreateProject:
+		return fmt.Sprintf("Offline: project queued as %s. Run 'cli-do sync' to send it.", e.Change.ProjectId)
+	case ChangeCreateTodo:
+		return fmt.Sprintf("Offline: todo queued with provisional ticket %s. Run 'cli-do sync' to send it.", e.Change.Ticket)
+	}
+
+	return fmt.Sprintf("Offline: change to todo %s queued. Run 'cli-do sync' to send it.", e.Change.Ticket)
+}
+
+func (e *QueuedError) Unwrap() error {
+	return ErrOffline
+}
+
+// reportQueued prints the notice for a change queued while offline to w and
+// reports whether err was one.
+func reportQueued(w io.Writer, err error) bool {
+	var queuedError *QueuedError
+
+	if !errors.As(err, &queuedError) {
+		return false
+	}
+
+	fmt.Fprintln(w, queuedError.Error())
+
+	return true
+}
+
+// requireSyncedQueue refuses to go on with a command that would drop the
+// queued changes of profile, unless --force is given.
+func requireSyncedQueue(ctx *cli.Context, profile string) error {
+	if ctx.Bool("force") {
+		return nil
+	}
+
+	queued, err := queuedChanges(profile)
+
+	if err != nil {
+		return err
+	}
+
+	if queued > 0 {
+		return NewUsageError("%d queued changes have not been synced. Run 'cli-do sync' first, or use --force to drop them.", queued)
+	}
+
+	return nil
+}
+
+// queuedChanges returns how many changes are queued for profile.
+func queuedChanges(profile string) (int, error) {
+	path, err := QueueFile(profile)
+
+	if err != nil {
+		return 0, err
+	}
+
+	queue, err := readQueue(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(queue.Changes), nil
+}
+
+func QueueFile(profile string) (string, error) {
+	dir, err := ProfileDir(profile)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "queue.json"), nil
+}
+
+func readQueue(path string) (changeQueue, error) {
+	var queue changeQueue
+	byteValue, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return queue, nil
+	}
+
+	if err != nil {
+		return queue, err
+	}
+
+	if err := json.Unmarshal(byteValue, &queue); err != nil {
+		return queue, fmt.Errorf("unable to read the offline queue %s: %w", path, err)
+	}
+
+	return queue, nil
+}
+
+func writeQueue(path string, queue changeQueue) error {
+	if len(queue.Changes) == 0 {
+		queue.Changes = []QueuedChange{}
+	}
+
+	bytes, err := json.MarshalIndent(queue, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, append(bytes, '\n'), 0600)
+}
+
+// queueLockTimeout is how long a command waits for another one to finish
+// with the offline queue.
+var queueLockTimeout = 10 * time.Second
+
+// lockQueue takes the lock file next to the queue at path, so that a sync
+// and the commands queueing changes do not overwrite each other's, and
+// returns the function releasing it.
+func lockQueue(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	var lockPath = path + ".lock"
+	var deadline = time.Now().Add(queueLockTimeout)
+
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+
+		if err == nil {
+			fmt.Fprintln(file, os.Getpid())
+			file.Close()
+
+			return func() { os.Remove(lockPath) }, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the offline queue is in use by another cli-do command; if none is running, remove %s", lockPath)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// enqueue appends change to the queue, giving created todos and projects
+// their provisional reference, and returns the QueuedError to report it.
+func (api *CachedApi) enqueue(change QueuedChange) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	unlock, err := lockQueue(api.queue)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	queue, err := readQueue(api.queue)
+
+	if err != nil {
+		return err
+	}
+
+	queue.Next++
+	change.Id = queue.Next
+	change.QueuedAt = time.Now()
+
+	switch change.Kind {
+	case ChangeCreateProject:
+		change.ProjectId = "local-" + strconv.Itoa(change.Id)
+	case ChangeCreateTodo:
+		change.Ticket = "L" + strconv.Itoa(change.Id)
+	default:
+		var cached = api.cachedTodo(change.ProjectId, change.Ticket)
+		change.Base = api.queuedTodo(queue, change.ProjectId, change.Ticket, cached)
+
+		// Only the first queued change to a todo is made against the server
+		// copy; later ones follow the changes queued before them.
+		if !hasQueuedChange(queue, change.ProjectId, change.Ticket) {
+			switch {
+			case change.UpdateTodo != nil && change.UpdateTodo.Todo.ETag != "":
+				change.BaseETag = change.UpdateTodo.Todo.ETag
+			case cached != nil:
+				change.BaseETag = cached.ETag
+			}
+		}
+	}
+
+	queue.Changes = append(queue.Changes, change)
+
+	if err := writeQueue(api.queue, queue); err != nil {
+		return err
+	}
+
+	return &QueuedError{Change: change}
+}
+
+// queuedTodo replays the queued changes to a todo on top of base, its cached
+// copy or nil for a todo created offline, so each change to it is based on
+// what the changes before it left. It returns nil for a todo that is neither
+// cached nor created offline, or that was archived since.
+func (api *CachedApi) queuedTodo(queue changeQueue, projectId string, ticket string, base *clido.Todo) *clido.Todo {
+	var todo = base
+
+	for _, change := range queue.Changes {
+		if change.ProjectId != projectId || change.Ticket != ticket {
+			continue
+		}
+
+		switch change.Kind {
+		case ChangeCreateTodo:
+			var created = change.CreateTodo.Todo
+			todo = &created
+		case ChangeUpdateTodo:
+			var updated = change.UpdateTodo.Todo
+			todo = &updated
+		case ChangeCompleteTodo:
+			if todo != nil {
+				var completed = *todo
+				completed.Completed = true
+				todo = &completed
+			}
+		case ChangeArchiveTodo:
+			todo = nil
+		}
+	}
+
+	return todo
+}
+
+// hasQueuedChange reports whether queue holds a change to a todo.
+func hasQueuedChange(queue changeQueue, projectId string, ticket string) bool {
+	for _, change := range queue.Changes {
+		if change.ProjectId == projectId && change.Ticket == ticket {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isProvisional reports whether a project Id or ticket was handed out while
+// offline and is not known to the server yet.
+func isProvisional(projectId string, ticket string) bool {
+	return provisionalProjectRegex.MatchString(projectId) || provisionalTicketRegex.MatchString(ticket)
+}
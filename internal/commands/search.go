@@ -0,0 +1,303 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/streed/cli-do-client/internal/query"
+	"github.com/urfave/cli/v2"
+)
+
+var savedQueryNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// SavedQuery is a named search kept under "queries" in a config file.
+type SavedQuery struct {
+	Name   string `json:"name" yaml:"name"`
+	Query  string `json:"query" yaml:"query"`
+	Source string `json:"source" yaml:"source"`
+}
+
+// HandleTodoSearch lists the todos of every project that match a query such
+// as 'due<7d AND NOT completed', or a saved one such as '@mine'.
+func HandleTodoSearch(ctx *cli.Context) error {
+	var input = strings.Join(ctx.Args().Slice(), " ")
+
+	if strings.TrimSpace(input) == "" {
+		return NewUsageError("A query is required, such as 'due<7d AND NOT completed' or @name.")
+	}
+
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	saved, err := LoadSavedQueries(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	expr, err := query.Parse(input, savedQueryMap(saved))
+
+	if err != nil {
+		return NewUsageError("Invalid query: %s", err)
+	}
+
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projects, err := api.GetProjects(ctx.Context)
+
+	if err != nil {
+		return err
+	}
+
+	var now = time.Now()
+
+	todos, err := ListProjectTodos(ctx.Context, api, projects.Projects, clido.TodoQuery{All: true}, now)
+
+	if err != nil {
+		return err
+	}
+
+	var matches = []ProjectTodo{}
+
+	for _, todo := range todos {
+		if expr.Eval(todo.Todo, todo.Project, now) {
+			matches = append(matches, todo)
+		}
+	}
+
+	return AgendaOutput(NewAgenda(matches, now)).Render(ctx)
+}
+
+// LoadSavedQueries reads the saved queries of the system, user, profile and
+// project files. A name defined in several takes the last one.
+func LoadSavedQueries(ctx *cli.Context, profile string) ([]SavedQuery, error) {
+	files, err := configFiles(ctx, profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var byName = map[string]SavedQuery{}
+
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+
+		queries, err := readSavedQueries(file.path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for name, text := range queries {
+			byName[name] = SavedQuery{Name: name, Query: text, Source: file.source}
+		}
+	}
+
+	var saved = make([]SavedQuery, 0, len(byName))
+
+	for _, savedQuery := range byName {
+		saved = append(saved, savedQuery)
+	}
+
+	sort.Slice(saved, func(i, j int) bool {
+		return saved[i].Name < saved[j].Name
+	})
+
+	return saved, nil
+}
+
+// readSavedQueries returns the queries saved in one config file, or none when
+// it does not exist.
+func readSavedQueries(path string) (map[string]string, error) {
+	byteValue, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var content struct {
+		Queries map[string]string `json:"queries"`
+	}
+
+	if err := json.Unmarshal(byteValue, &content); err != nil {
+		return nil, NewUsageError("Unable to read saved queries from %s: %s", path, err)
+	}
+
+	return content.Queries, nil
+}
+
+func savedQueryMap(saved []SavedQuery) map[string]string {
+	var queries = make(map[string]string, len(saved))
+
+	for _, savedQuery := range saved {
+		queries[savedQuery.Name] = savedQuery.Query
+	}
+
+	return queries
+}
+
+// HandleQuerySave stores a query under a name in the active profile's config
+// file, after checking it parses.
+func HandleQuerySave(ctx *cli.Context) error {
+	if ctx.Args().Len() < 2 {
+		return NewUsageError("Usage: cli-do query save <name> <query>")
+	}
+
+	var name = strings.TrimPrefix(ctx.Args().First(), "@")
+	var text = strings.Join(ctx.Args().Tail(), " ")
+
+	if !savedQueryNameRegex.MatchString(name) {
+		return NewUsageError("Invalid query name %q: use letters, digits, - and _.", name)
+	}
+
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	saved, err := LoadSavedQueries(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	var queries = savedQueryMap(saved)
+	queries[name] = text
+
+	if _, err := query.Parse(text, queries); err != nil {
+		return NewUsageError("Invalid query: %s", err)
+	}
+
+	path, err := ConfigFile(profile)
+
+	if err != nil {
+		return err
+	}
+
+	err = updateConfigFile(path, func(values map[string]interface{}) {
+		var stored, _ = values["queries"].(map[string]interface{})
+
+		if stored == nil {
+			stored = map[string]interface{}{}
+		}
+
+		stored[name] = text
+		values["queries"] = stored
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "Saved query @%s.\n", name)
+
+	return nil
+}
+
+func HandleQueryList(ctx *cli.Context) error {
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	saved, err := LoadSavedQueries(ctx, profile)
+
+	if err != nil {
+		return err
+	}
+
+	var items = make([]interface{}, 0, len(saved))
+
+	for _, savedQuery := range saved {
+		items = append(items, savedQuery)
+	}
+
+	return Output{
+		Value:   saved,
+		Items:   items,
+		Columns: []string{"name", "query", "source"},
+		Record: func(item interface{}) []string {
+			var savedQuery = item.(SavedQuery)
+
+			return []string{savedQuery.Name, savedQuery.Query, savedQuery.Source}
+		},
+		Table: func(w io.Writer) {
+			var tbl = table.New("Name", "Query", "Source").WithWriter(w)
+
+			for _, savedQuery := range saved {
+				tbl.AddRow("@"+savedQuery.Name, savedQuery.Query, savedQuery.Source)
+			}
+
+			tbl.Print()
+		},
+	}.Render(ctx)
+}
+
+// HandleQueryRemove deletes a saved query from the active profile's config
+// file. Queries from other files have to be removed there.
+func HandleQueryRemove(ctx *cli.Context) error {
+	var name = strings.TrimPrefix(ctx.Args().First(), "@")
+
+	if name == "" {
+		return NewUsageError("A query name is required.")
+	}
+
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	path, err := ConfigFile(profile)
+
+	if err != nil {
+		return err
+	}
+
+	queries, err := readSavedQueries(path)
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := queries[name]; !ok {
+		return NewUsageError("No saved query %q in %s.", name, path)
+	}
+
+	err = updateConfigFile(path, func(values map[string]interface{}) {
+		var stored, _ = values["queries"].(map[string]interface{})
+		delete(stored, name)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "Removed query @%s.\n", name)
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func TestHandleTodoSearch(t *testing.T) {
+	var server = setup(t)
+	var today = time.Now()
+	var soon = time.Date(today.Year(), today.Month(), today.Day()+2, 0, 0, 0, 0, time.UTC)
+	var later = time.Date(today.Year(), today.Month(), today.Day()+30, 0, 0, 0, 0, time.UTC)
+
+	var ops = server.AddProject("Operations", "")
+	var web = server.AddProject("Website", "")
+
+	_, _ = server.AddTodo(ops.Id, clidotest.Todo{Subject: "Cut the release", DueDate: &soon})
+	_, _ = server.AddTodo(ops.Id, clidotest.Todo{Subject: "Release notes", DueDate: &later})
+	_, _ = server.AddTodo(web.Id, clidotest.Todo{Subject: "Release banner", DueDate: &soon, Completed: true})
+	_, _ = server.AddTodo(web.Id, clidotest.Todo{Subject: "Fix the footer", DueDate: &soon})
+
+	var search = func(args ...string) []AgendaItem {
+		t.Helper()
+
+		out, err := run(t, append([]string{"-o", "json", "todo", "search"}, args...)...)
+
+		if err != nil {
+			t.Fatalf("todo search %v: %v", args, err)
+		}
+
+		var items []AgendaItem
+
+		if err := json.Unmarshal([]byte(out), &items); err != nil {
+			t.Fatalf("decode %q: %v", out, err)
+		}
+
+		return items
+	}
+
+	var items = search(`due<7d AND NOT completed AND subject~"release"`)
+
+	if len(items) != 1 || items[0].Subject != "Cut the release" || items[0].Ref != ops.Key+"-1" {
+		t.Fatalf("unexpected items %+v", items)
+	}
+
+	if items = search("completed"); len(items) != 1 || items[0].Subject != "Release banner" {
+		t.Fatalf("expected completed todos to be searched, got %+v", items)
+	}
+
+	if items = search("project~web", "OR", "ticket=2"); len(items) != 3 {
+		t.Fatalf("expected the query to be joined from every argument, got %+v", items)
+	}
+
+	if _, err := run(t, "query", "save", "open", "NOT completed"); err != nil {
+		t.Fatalf("query save: %v", err)
+	}
+
+	if _, err := run(t, "query", "save", "mine-this-week", "@open AND due<7d"); err != nil {
+		t.Fatalf("query save: %v", err)
+	}
+
+	if items = search("@mine-this-week"); len(items) != 2 {
+		t.Fatalf("expected the saved query to match two todos, got %+v", items)
+	}
+
+	_, err := run(t, "todo", "search", "due<soon")
+
+	if ExitCode(err) != ExitUsage {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitUsage)
+	}
+
+	_, err = run(t, "todo", "search")
+
+	if ExitCode(err) != ExitUsage {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitUsage)
+	}
+}
+
+func TestSavedQueries(t *testing.T) {
+	setup(t)
+
+	if _, err := run(t, "query", "save", "open", "NOT completed"); err != nil {
+		t.Fatalf("query save: %v", err)
+	}
+
+	writeJsonFile(t, ProjectSettingsFile, map[string]interface{}{
+		"queries": map[string]string{"open": "completed=false", "due": "due<7d"},
+	})
+
+	out, err := run(t, "-o", "json", "query", "list")
+
+	if err != nil {
+		t.Fatalf("query list: %v", err)
+	}
+
+	var saved []SavedQuery
+
+	if err := json.Unmarshal([]byte(out), &saved); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+
+	if len(saved) != 2 || saved[1].Name != "open" || saved[1].Source != ConfigSourceProject {
+		t.Fatalf("expected the project file to override the profile, got %+v", saved)
+	}
+
+	for _, args := range [][]string{
+		{"query", "save", "bad name", "completed"},
+		{"query", "save", "loop", "@loop"},
+		{"query", "save", "broken", "ticket<"},
+	} {
+		if _, err := run(t, args...); ExitCode(err) != ExitUsage {
+			t.Fatalf("%v: got exit code %d for %v, want %d", args, ExitCode(err), err, ExitUsage)
+		}
+	}
+
+	if _, err := run(t, "query", "remove", "@open"); err != nil {
+		t.Fatalf("query remove: %v", err)
+	}
+
+	path, err := ConfigFile(DefaultProfile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "query", "remove", "open"); ExitCode(err) != ExitUsage {
+		t.Fatalf("removing twice: got exit code %d for %v, want %d", ExitCode(err), err, ExitUsage)
+	}
+
+	if after, err := os.ReadFile(path); err != nil || string(after) != string(before) {
+		t.Fatalf("removing twice rewrote %s: %q, %v", path, after, err)
+	}
+}
+
+func TestQueryRemoveMissingCreatesNoFile(t *testing.T) {
+	setup(t)
+
+	path, err := ConfigFile(DefaultProfile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "query", "remove", "nothing"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitUsage)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %s not to be created, got %v", path, err)
+	}
+}
@@ -0,0 +1,417 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// Outcomes of replaying a queued change.
+const (
+	SyncSynced   = "synced"
+	SyncConflict = "conflict"
+	SyncFailed   = "failed"
+	SyncBlocked  = "blocked"
+	SyncPending  = "pending"
+)
+
+// SyncResult is what happened to one queued change.
+type SyncResult struct {
+	Id     int    `json:"id" yaml:"id"`
+	Kind   string `json:"kind" yaml:"kind"`
+	Ref    string `json:"ref" yaml:"ref"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// HandleSync sends the changes queued while offline, in the order they were
+// made. Todos and projects created offline get their real tickets and Ids,
+// and later changes to them follow. A change to a todo that changed on the
+// server since it was queued is a conflict and stays queued, as does
+// anything after it touching the same todo, unless --force is given.
+func HandleSync(ctx *cli.Context) error {
+	if ctx.Bool("offline") {
+		return NewUsageError("cli-do sync needs the server. Drop --offline to run it.")
+	}
+
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	path, err := QueueFile(profile)
+
+	if err != nil {
+		return err
+	}
+
+	// The queue stays locked until every change was sent, so that changes
+	// queued meanwhile wait instead of being overwritten.
+	unlock, err := lockQueue(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	queue, err := readQueue(path)
+
+	if err != nil {
+		return err
+	}
+
+	if drop := ctx.IntSlice("drop"); len(drop) > 0 {
+		return dropQueuedChanges(ctx.App.Writer, path, queue, drop)
+	}
+
+	if ctx.Bool("dry-run") {
+		return QueueOutput(queue.Changes).Render(ctx)
+	}
+
+	if len(queue.Changes) == 0 {
+		fmt.Fprintln(ctx.App.Writer, "Nothing to sync.")
+		return nil
+	}
+
+	api, err := newCachedApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var results = []SyncResult{}
+	var remaining = []QueuedChange{}
+	var blocked = map[string]bool{}
+	var stopErr error
+
+	for i := 0; i < len(queue.Changes); i++ {
+		var change = queue.Changes[i]
+		var result = SyncResult{Id: change.Id, Kind: change.Kind, Ref: changeRef(change), Status: SyncSynced}
+		var keys = changeKeys(change)
+
+		switch {
+		case stopErr != nil:
+			result.Status = SyncPending
+		case blocked[keys[0]] || blocked[keys[len(keys)-1]]:
+			result.Status = SyncBlocked
+			result.Detail = "waits for an earlier change that was not synced"
+		default:
+			current, conflict, err := checkConflict(ctx.Context, api.Api, change)
+
+			if err == nil && conflict != "" && !ctx.Bool("force") {
+				result.Status = SyncConflict
+				result.Detail = conflict
+				break
+			}
+
+			// The edit was checked against, or forced over, the current copy.
+			// Otherwise the server checks it against the copy it was made on.
+			if change.UpdateTodo != nil {
+				switch {
+				case current != nil:
+					change.UpdateTodo.Todo.ETag = current.ETag
+				case ctx.Bool("force"):
+					change.UpdateTodo.Todo.ETag = ""
+				default:
+					change.UpdateTodo.Todo.ETag = change.BaseETag
+				}
+			}
+
+			if err == nil {
+				err = applyChange(ctx.Context, api, queue.Changes[i+1:], &change, &result)
+			}
+
+			if errors.Is(err, clido.ErrConflict) {
+				result.Status = SyncConflict
+				result.Detail = "changed on the server since the change was queued"
+			} else if err != nil {
+				result.Status = SyncFailed
+				result.Detail = err.Error()
+
+				if isNetworkError(err) {
+					stopErr = err
+				}
+
+				// A change that timed out may have been applied already.
+				if isNetworkError(err) && !isUnreachable(err) {
+					result.Detail = fmt.Sprintf("may have reached the server; check whether it was made, then drop it with --drop %d or sync again: %s", change.Id, err)
+				}
+			}
+		}
+
+		if result.Status != SyncSynced {
+			remaining = append(remaining, change)
+			blocked[keys[len(keys)-1]] = true
+		}
+
+		results = append(results, result)
+
+		if err := writeQueue(path, changeQueue{Next: queue.Next, Changes: append(append([]QueuedChange{}, remaining...), queue.Changes[i+1:]...)}); err != nil {
+			return err
+		}
+	}
+
+	if err := SyncOutput(results).Render(ctx); err != nil {
+		return err
+	}
+
+	if stopErr != nil {
+		return fmt.Errorf("the server could not be reached, %d changes stay queued: %w", len(remaining), stopErr)
+	}
+
+	if len(remaining) > 0 {
+		return fmt.Errorf("%d changes could not be synced and stay queued; sync again once fixed, send them anyway with --force or remove them with --drop", len(remaining))
+	}
+
+	return nil
+}
+
+// changeKeys names what a change touches: its project, and its todo for
+// changes to one. A change that is not synced blocks its last key, so later
+// changes to the same todo, or to a project that was not created, wait.
+func changeKeys(change QueuedChange) []string {
+	var project = "project " + change.ProjectId
+
+	if change.Kind == ChangeCreateProject || change.Ticket == "" {
+		return []string{project}
+	}
+
+	return []string{project, "todo " + change.ProjectId + "/" + change.Ticket}
+}
+
+func changeRef(change QueuedChange) string {
+	if change.Kind == ChangeCreateProject {
+		return change.ProjectId
+	}
+
+	return change.Ticket
+}
+
+// checkConflict compares the server copy of the todo a change edits with
+// the copy it was made against, and describes how they differ. An edit made
+// without a copy to compare with is left to the server to check by its
+// ETag, and is a conflict when there is none either.
+func checkConflict(ctx context.Context, api clido.Api, change QueuedChange) (*clido.Todo, string, error) {
+	if change.Kind == ChangeCreateTodo || change.Kind == ChangeCreateProject {
+		return nil, "", nil
+	}
+
+	if change.Base == nil {
+		if change.Kind == ChangeUpdateTodo && change.BaseETag == "" {
+			return nil, "the todo was not cached when the change was queued, so changes made on the server since cannot be checked", nil
+		}
+
+		return nil, "", nil
+	}
+
+	current, err := api.GetTodo(ctx, change.ProjectId, change.Ticket)
+
+	if errors.Is(err, clido.ErrNotFound) {
+		return nil, "the todo no longer exists on the server", nil
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var base = *change.Base
+	var differences []string
+
+	if current.Subject != base.Subject {
+		differences = append(differences, fmt.Sprintf("subject is now %q", current.Subject))
+	}
+
+	if current.Body != base.Body {
+		differences = append(differences, "body changed")
+	}
+
+	if !sameDueDate(current.DueDate, base.DueDate) {
+		differences = append(differences, fmt.Sprintf("due date is now %s", formatDueDate(current.DueDate)))
+	}
+
+	if current.Completed != base.Completed {
+		differences = append(differences, fmt.Sprintf("completed is now %t", current.Completed))
+	}
+
+	if len(differences) == 0 {
+		return &current, "", nil
+	}
+
+	return &current, "changed on the server: " + strings.Join(differences, ", "), nil
+}
+
+func sameDueDate(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+func formatDueDate(dueDate *time.Time) string {
+	if dueDate == nil {
+		return "none"
+	}
+
+	return dueDate.Format("2006-01-02")
+}
+
+// applyChange sends change to the server. A todo or project created offline
+// has its provisional reference replaced in the changes still to come.
+func applyChange(ctx context.Context, api *CachedApi, later []QueuedChange, change *QueuedChange, result *SyncResult) error {
+	defer api.invalidate("projects.json", projectCachePath(change.ProjectId))
+
+	switch change.Kind {
+	case ChangeCreateProject:
+		project, err := api.Api.CreateProject(ctx, *change.CreateProject)
+
+		if err != nil {
+			return err
+		}
+
+		for i := range later {
+			if later[i].ProjectId == change.ProjectId {
+				later[i].ProjectId = project.Id
+			}
+		}
+
+		result.Detail = "created as " + project.Id
+	case ChangeCreateTodo:
+		todo, err := api.Api.CreateTodo(ctx, change.ProjectId, *change.CreateTodo)
+
+		if err != nil {
+			return err
+		}
+
+		var ticket = strconv.Itoa(todo.Ticket)
+
+		for i := range later {
+			if later[i].ProjectId == change.ProjectId && later[i].Ticket == change.Ticket {
+				later[i].Ticket = ticket
+			}
+		}
+
+		result.Detail = "created as ticket " + ticket
+	case ChangeUpdateTodo:
+		return api.Api.UpdateTodo(ctx, change.ProjectId, change.Ticket, *change.UpdateTodo)
+	case ChangeCompleteTodo:
+		return api.Api.CompleteTodo(ctx, change.ProjectId, change.Ticket)
+	case ChangeArchiveTodo:
+		return api.Api.ArchiveTodo(ctx, change.ProjectId, change.Ticket)
+	default:
+		return fmt.Errorf("unknown change %q", change.Kind)
+	}
+
+	return nil
+}
+
+func dropQueuedChanges(w io.Writer, path string, queue changeQueue, ids []int) error {
+	var drop = map[int]bool{}
+
+	for _, id := range ids {
+		drop[id] = true
+	}
+
+	var kept = []QueuedChange{}
+
+	for _, change := range queue.Changes {
+		if drop[change.Id] {
+			delete(drop, change.Id)
+			continue
+		}
+
+		kept = append(kept, change)
+	}
+
+	for id := range drop {
+		return NewNotFoundError("No queued change %d.", id)
+	}
+
+	queue.Changes = kept
+
+	if err := writeQueue(path, queue); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Dropped %d queued changes.\n", len(ids))
+
+	return nil
+}
+
+func QueueOutput(changes []QueuedChange) Output {
+	var items = make([]interface{}, 0, len(changes))
+
+	for _, change := range changes {
+		items = append(items, change)
+	}
+
+	return Output{
+		Value:   changes,
+		Items:   items,
+		Columns: []string{"id", "kind", "project_id", "ticket", "summary", "queued_at"},
+		Record: func(item interface{}) []string {
+			var change = item.(QueuedChange)
+
+			return []string{
+				strconv.Itoa(change.Id),
+				change.Kind,
+				change.ProjectId,
+				change.Ticket,
+				change.Summary(),
+				change.QueuedAt.Format(time.RFC3339),
+			}
+		},
+		Table: func(w io.Writer) {
+			if len(changes) == 0 {
+				fmt.Fprintln(w, "Nothing to sync.")
+				return
+			}
+
+			var tbl = table.New("Id", "Change", "Project", "Ticket", "Summary").WithWriter(w)
+
+			for _, change := range changes {
+				tbl.AddRow(change.Id, change.Kind, change.ProjectId, change.Ticket, change.Summary())
+			}
+
+			tbl.Print()
+		},
+	}
+}
+
+func SyncOutput(results []SyncResult) Output {
+	var items = make([]interface{}, 0, len(results))
+
+	for _, result := range results {
+		items = append(items, result)
+	}
+
+	return Output{
+		Value:   results,
+		Items:   items,
+		Columns: []string{"id", "kind", "ref", "status", "detail"},
+		Record: func(item interface{}) []string {
+			var result = item.(SyncResult)
+
+			return []string{strconv.Itoa(result.Id), result.Kind, result.Ref, result.Status, result.Detail}
+		},
+		Table: func(w io.Writer) {
+			var tbl = table.New("Id", "Change", "Ref", "Status", "Detail").WithWriter(w)
+
+			for _, result := range results {
+				tbl.AddRow(result.Id, result.Kind, result.Ref, result.Status, result.Detail)
+			}
+
+			tbl.Print()
+		},
+	}
+}
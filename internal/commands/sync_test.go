@@ -0,0 +1,327 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func TestSyncQueuedChanges(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Walk the dog"})
+
+	if _, err := run(t, "-p", project.Id, "todo", "list"); err != nil {
+		t.Fatalf("todo list: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"--offline", "project", "new", "--name", "Errands"},
+		{"--offline", "-p", "local-1", "todo", "new", "--subject", "Post a letter"},
+		{"--offline", "-p", project.Id, "todo", "new", "--subject", "Call home"},
+		{"--offline", "-p", project.Id, "todo", "complete", "L3"},
+		{"--offline", "-p", project.Id, "todo", "complete", "1"},
+		{"--offline", "-p", project.Id, "todo", "archive", "2"},
+	} {
+		if _, err := run(t, args...); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); todo.Completed {
+		t.Fatal("expected offline changes not to reach the server")
+	}
+
+	// Someone else completes todo 2 before the queued archive is sent.
+	if _, err := run(t, "-p", project.Id, "todo", "complete", "2"); err != nil {
+		t.Fatalf("todo complete: %v", err)
+	}
+
+	out, err := run(t, "-o", "json", "sync", "--dry-run")
+
+	if err != nil {
+		t.Fatalf("sync --dry-run: %v", err)
+	}
+
+	var changes []QueuedChange
+
+	if err := json.Unmarshal([]byte(out), &changes); err != nil || len(changes) != 6 {
+		t.Fatalf("expected six queued changes, got %q", out)
+	}
+
+	out, err = run(t, "-o", "json", "sync")
+
+	if err == nil {
+		t.Fatal("expected the conflict to fail sync")
+	}
+
+	var results []SyncResult
+
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+
+	for i, result := range results[:5] {
+		if result.Status != SyncSynced {
+			t.Fatalf("change %d: got %+v, want synced", i+1, result)
+		}
+	}
+
+	if results[5].Status != SyncConflict || !strings.Contains(results[5].Detail, "completed is now true") {
+		t.Fatalf("expected the archive to conflict, got %+v", results[5])
+	}
+
+	if todo, _ := server.Todo(project.Id, 3); todo.Subject != "Call home" || !todo.Completed {
+		t.Fatalf("expected the provisional ticket to map to ticket 3, got %+v", todo)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); !todo.Completed {
+		t.Fatal("expected todo 1 to be completed")
+	}
+
+	out, _ = run(t, "-o", "json", "project", "list")
+
+	var projects []clido.Project
+
+	if err := json.Unmarshal([]byte(out), &projects); err != nil || len(projects) != 2 {
+		t.Fatalf("expected the queued project to be created, got %q", out)
+	}
+
+	var errands = projects[0]
+
+	if errands.Name != "Errands" {
+		errands = projects[1]
+	}
+
+	if todo, ok := server.Todo(errands.Id, 1); !ok || todo.Subject != "Post a letter" {
+		t.Fatalf("expected the todo to follow its provisional project, got %+v", todo)
+	}
+
+	if _, err := run(t, "sync", "--force"); err != nil {
+		t.Fatalf("sync --force: %v", err)
+	}
+
+	if todo, _ := server.Todo(project.Id, 2); !todo.Archived {
+		t.Fatal("expected --force to send the conflicting archive")
+	}
+
+	if out, _ := run(t, "sync"); !strings.Contains(out, "Nothing to sync.") {
+		t.Fatalf("expected an empty queue, got %q", out)
+	}
+}
+
+func TestSyncSuccessiveChangesToOneTodo(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	if _, err := run(t, "-p", project.Id, "todo", "list"); err != nil {
+		t.Fatalf("todo list: %v", err)
+	}
+
+	// The archive is based on the todo as the queued completion leaves it,
+	// so the completion synced just before it is not a conflict.
+	for _, args := range [][]string{
+		{"--offline", "-p", project.Id, "todo", "complete", "1"},
+		{"--offline", "-p", project.Id, "todo", "archive", "1"},
+	} {
+		if _, err := run(t, args...); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+
+	if out, err := run(t, "sync"); err != nil {
+		t.Fatalf("sync: %v\n%s", err, out)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); !todo.Completed || !todo.Archived {
+		t.Fatalf("expected the todo to be completed and archived, got %+v", todo)
+	}
+}
+
+func TestSyncKeepsChangesQueuedMeanwhile(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	if _, err := run(t, "--offline", "-p", project.Id, "todo", "new", "--subject", "Buy milk"); err != nil {
+		t.Fatalf("todo new: %v", err)
+	}
+
+	var requests = server.Requests()
+	var done = make(chan error)
+	server.SlowNext(300 * time.Millisecond)
+
+	go func() {
+		_, err := run(t, "sync")
+		done <- err
+	}()
+
+	for server.Requests() == requests {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Queued while the sync is still waiting for the server.
+	if _, err := run(t, "--offline", "-p", project.Id, "todo", "new", "--subject", "Walk the dog"); err != nil {
+		t.Fatalf("todo new: %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	out, err := run(t, "-o", "json", "sync", "--dry-run")
+
+	if err != nil {
+		t.Fatalf("sync --dry-run: %v", err)
+	}
+
+	var changes []QueuedChange
+
+	if err := json.Unmarshal([]byte(out), &changes); err != nil || len(changes) != 1 || changes[0].Id != 2 || changes[0].Ticket != "L2" {
+		t.Fatalf("expected the todo queued during sync to stay queued as L2, got %q", out)
+	}
+}
+
+func TestSyncEditOfUncachedTodo(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	var path, _ = QueueFile(DefaultProfile)
+	var queueEdit = func(baseETag string) {
+		t.Helper()
+
+		var change = QueuedChange{
+			Id:         1,
+			Kind:       ChangeUpdateTodo,
+			ProjectId:  project.Id,
+			Ticket:     "1",
+			UpdateTodo: &clido.UpdateTodo{Todo: clido.Todo{Ticket: 1, Subject: "Buy oat milk"}},
+			BaseETag:   baseETag,
+		}
+
+		if err := writeQueue(path, changeQueue{Next: 1, Changes: []QueuedChange{change}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var subject = func() string {
+		var todo, _ = server.Todo(project.Id, 1)
+		return todo.Subject
+	}
+
+	queueEdit("")
+
+	if out, err := run(t, "sync"); err == nil || !strings.Contains(out, "cannot be checked") || subject() != "Buy milk" {
+		t.Fatalf("expected an edit without a base to be a conflict, got %q, %v", out, err)
+	}
+
+	queueEdit(`"stale"`)
+
+	if out, err := run(t, "sync"); err == nil || !strings.Contains(out, "since the change was queued") || subject() != "Buy milk" {
+		t.Fatalf("expected the server to refuse an edit of a changed todo, got %q, %v", out, err)
+	}
+
+	var config = clido.DefaultConfig()
+	config.Endpoint = server.URL
+	var auth, _ = GetAuth(DefaultProfile)
+	todo, err := clido.NewClient(config, clido.WithAuth(auth)).GetTodo(context.Background(), project.Id, "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queueEdit(todo.ETag)
+
+	if out, err := run(t, "sync"); err != nil || subject() != "Buy oat milk" {
+		t.Fatalf("expected the edit of an unchanged todo to sync, got %q, %v", out, err)
+	}
+
+	queueEdit("")
+	_ = server.EditTodo(project.Id, 1, func(todo *clidotest.Todo) { todo.Subject = "Buy bread" })
+
+	if out, err := run(t, "sync", "--force"); err != nil || subject() != "Buy oat milk" {
+		t.Fatalf("expected --force to send the edit, got %q, %v", out, err)
+	}
+}
+
+func TestSyncDrop(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	if _, err := run(t, "--offline", "-p", project.Id, "todo", "new", "--subject", "Never mind"); err != nil {
+		t.Fatalf("todo new: %v", err)
+	}
+
+	if _, err := run(t, "sync", "--drop", "2"); ExitCode(err) != ExitNotFound {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitNotFound)
+	}
+
+	if out, err := run(t, "sync", "--drop", "1"); err != nil || !strings.Contains(out, "Dropped 1 queued changes.") {
+		t.Fatalf("sync --drop: %q, %v", out, err)
+	}
+
+	if out, _ := run(t, "sync"); !strings.Contains(out, "Nothing to sync.") {
+		t.Fatalf("expected an empty queue, got %q", out)
+	}
+
+	if _, ok := server.Todo(project.Id, 1); ok {
+		t.Fatal("expected the dropped todo never to be created")
+	}
+}
+
+func TestQueueWhenUnreachable(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	server.Close()
+
+	if out, err := run(t, "-p", project.Id, "todo", "new", "--subject", "On a plane"); err != nil || !strings.Contains(out, "queued with provisional ticket L1") {
+		t.Fatalf("expected the todo to be queued, got %q, %v", out, err)
+	}
+
+	out, err := run(t, "-o", "json", "sync", "--dry-run")
+
+	if err != nil {
+		t.Fatalf("sync --dry-run: %v", err)
+	}
+
+	var changes []QueuedChange
+
+	if err := json.Unmarshal([]byte(out), &changes); err != nil || len(changes) != 1 || changes[0].Ticket != "L1" {
+		t.Fatalf("expected one queued todo, got %q", out)
+	}
+
+	if _, err := run(t, "sync"); ExitCode(err) != ExitNetwork {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitNetwork)
+	}
+}
+
+func TestTimeoutIsNotQueued(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	t.Setenv("CLI_DO_TIMEOUT", "50ms")
+	t.Setenv("CLI_DO_MAX_RETRIES", "0")
+
+	// The server creates the todo but answers after the client gave up, so
+	// queuing it would create it a second time on sync.
+	server.SlowNext(500 * time.Millisecond)
+
+	_, err := run(t, "-p", project.Id, "todo", "new", "--subject", "Buy milk")
+
+	if ExitCode(err) != ExitNetwork || !strings.Contains(err.Error(), "not queued") {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitNetwork)
+	}
+
+	if _, ok := server.Todo(project.Id, 1); !ok {
+		t.Fatal("expected the server to have created the todo")
+	}
+
+	if out, _ := run(t, "sync", "--dry-run"); !strings.Contains(out, "Nothing to sync.") {
+		t.Fatalf("expected nothing to be queued, got %q", out)
+	}
+}
@@ -0,0 +1,300 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"gopkg.in/yaml.v3"
+)
+
+// A todo file holds a todo's fields as YAML front matter between two ---
+// lines, followed by its body:
+//
+//	---
+//	# Ticket 12
+//	subject: Buy milk
+//	completed: false
+//	due_date: 2024-05-01
+//	---
+//	Oat, two cartons.
+//
+// Comment lines above the front matter are ignored; they are where the
+// editor loop reports why the file could not be read.
+
+// errEditCancelled is returned when the todo file is saved empty, or with
+// neither a subject nor a body.
+var errEditCancelled = errors.New("edit cancelled, the todo file was empty")
+
+var errNoSubject = errors.New("subject must not be empty")
+
+type todoFrontMatter struct {
+	Subject   string `yaml:"subject"`
+	Completed bool   `yaml:"completed"`
+	DueDate   string `yaml:"due_date"`
+}
+
+// WriteToTempFile writes todo to a new file in the system temp directory and
+// returns its path.
+func WriteToTempFile(todo clido.Todo) (string, error) {
+	var file, err = os.CreateTemp("", "cli-do-todo-*.md")
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	return file.Name(), WriteTodoFile(file.Name(), todo)
+}
+
+// WriteTodoFile writes todo to path in the format ParseTodoFile reads.
+func WriteTodoFile(path string, todo clido.Todo) error {
+	content, err := FormatTodoFile(todo)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(content), 0600)
+}
+
+// FormatTodoFile renders todo as a todo file.
+func FormatTodoFile(todo clido.Todo) (string, error) {
+	var frontMatter = todoFrontMatter{Subject: todo.Subject, Completed: todo.Completed, DueDate: formatDueDate(todo.DueDate)}
+	fields, err := yaml.Marshal(frontMatter)
+
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	content.WriteString("---\n")
+
+	if todo.Ticket != 0 {
+		fmt.Fprintf(&content, "# Ticket %d\n", todo.Ticket)
+	}
+
+	content.Write(fields)
+	content.WriteString("---\n")
+
+	if todo.Body != "" {
+		content.WriteString(strings.TrimRight(todo.Body, "\n") + "\n")
+	}
+
+	return content.String(), nil
+}
+
+// sameTodoFile reports whether a and b render to the same todo file, so
+// saving one over the other changes nothing that can be edited.
+func sameTodoFile(a clido.Todo, b clido.Todo) bool {
+	contentA, errA := FormatTodoFile(a)
+	contentB, errB := FormatTodoFile(b)
+
+	return errA == nil && errB == nil && contentA == contentB
+}
+
+// ParseTodoFile reads the fields and body of a todo file on top of todo, so
+// what the file does not hold, such as the ticket and ETag, is kept.
+func ParseTodoFile(todo clido.Todo, content string) (clido.Todo, error) {
+	var lines = strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	var start = 0
+
+	for start < len(lines) && (strings.TrimSpace(lines[start]) == "" || strings.HasPrefix(lines[start], "#")) {
+		start++
+	}
+
+	if start == len(lines) || strings.TrimSpace(lines[start]) != "---" {
+		return todo, errors.New("the file must start with a --- line opening the front matter")
+	}
+
+	var end = start + 1
+
+	for end < len(lines) && strings.TrimSpace(lines[end]) != "---" {
+		end++
+	}
+
+	if end == len(lines) {
+		return todo, errors.New("the front matter is not closed by a --- line")
+	}
+
+	var body = strings.TrimRight(strings.Join(lines[end+1:], "\n"), "\n")
+	todo, err := parseFrontMatter(todo, strings.Join(lines[start+1:end], "\n"))
+
+	if errors.Is(err, errNoSubject) && strings.TrimSpace(body) == "" {
+		return todo, errEditCancelled
+	}
+
+	if err != nil {
+		return todo, err
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") || strings.HasPrefix(line, "||||||| ") {
+			return todo, errors.New("the body still has conflict markers, keep the lines you want and remove the markers")
+		}
+	}
+
+	todo.Body = body
+
+	return todo, nil
+}
+
+func parseFrontMatter(todo clido.Todo, frontMatter string) (clido.Todo, error) {
+	var document yaml.Node
+
+	if err := yaml.Unmarshal([]byte(frontMatter), &document); err != nil {
+		return todo, fmt.Errorf("the front matter is not valid YAML: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return todo, errors.New("the front matter must hold fields such as subject: Buy milk")
+	}
+
+	var fields = document.Content[0].Content
+	var seen = map[string]bool{}
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		var name, value = fields[i].Value, fields[i+1]
+
+		if seen[name] {
+			return todo, fmt.Errorf("%s is set more than once", name)
+		}
+
+		seen[name] = true
+
+		if value.Kind != yaml.ScalarNode {
+			return todo, fmt.Errorf("%s must be a single value", name)
+		}
+
+		switch name {
+		case "subject":
+			todo.Subject = strings.TrimSpace(value.Value)
+
+			if todo.Subject == "" {
+				return todo, errNoSubject
+			}
+		case "completed":
+			switch value.Value {
+			case "true":
+				todo.Completed = true
+			case "false":
+				todo.Completed = false
+			default:
+				return todo, fmt.Errorf("completed must be true or false, not %q", value.Value)
+			}
+		case "due_date":
+			switch value.Value {
+			case "", "none", "null", "~":
+				todo.DueDate = nil
+			default:
+				dueDate, err := time.Parse("2006-01-02", value.Value)
+
+				if err != nil {
+					return todo, fmt.Errorf("due_date must be a date such as 2024-05-01 or none, not %q", value.Value)
+				}
+
+				todo.DueDate = &dueDate
+			}
+		default:
+			return todo, fmt.Errorf("unknown field %q, the fields are subject, completed and due_date", name)
+		}
+	}
+
+	if !seen["subject"] {
+		return todo, errNoSubject
+	}
+
+	return todo, nil
+}
+
+// annotateTodoFile replaces the comments above the front matter of content
+// with the reason it could not be read.
+func annotateTodoFile(content string, err error) string {
+	var lines = strings.Split(content, "\n")
+	var start = 0
+
+	for start < len(lines) && strings.HasPrefix(lines[start], "#") {
+		start++
+	}
+
+	var annotation strings.Builder
+	annotation.WriteString("# The todo could not be saved:\n")
+
+	for _, line := range strings.Split(err.Error(), "\n") {
+		annotation.WriteString("#   " + line + "\n")
+	}
+
+	annotation.WriteString("# Fix it and save again, or empty the file to cancel.\n")
+
+	return annotation.String() + strings.Join(lines[start:], "\n")
+}
+
+// EditorPath returns the editor to open files in: $VISUAL, then $EDITOR,
+// then vim.
+func EditorPath() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editorPath := os.Getenv(name); editorPath != "" {
+			return editorPath
+		}
+	}
+
+	return "vim"
+}
+
+// EditTodoFile writes todo to path, opens it in $EDITOR and reads back the
+// result. A file that cannot be read is reopened with the error noted at the
+// top, until it is fixed, emptied to cancel, or saved unchanged. The file is
+// left in place for the caller to remove.
+func EditTodoFile(todo clido.Todo, path string) (clido.Todo, error) {
+	if err := WriteTodoFile(path, todo); err != nil {
+		return todo, err
+	}
+
+	var annotated []byte
+
+	for {
+		cmd := exec.Command(EditorPath(), path)
+
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return todo, fmt.Errorf("editor exited with an error: %w", err)
+		}
+
+		content, err := os.ReadFile(path)
+
+		if err != nil {
+			return todo, err
+		}
+
+		if len(bytes.TrimSpace(content)) == 0 {
+			return todo, errEditCancelled
+		}
+
+		updatedTodo, err := ParseTodoFile(todo, string(content))
+
+		if err == nil || errors.Is(err, errEditCancelled) {
+			return updatedTodo, err
+		}
+
+		if annotated != nil && bytes.Equal(content, annotated) {
+			return todo, NewUsageError("The todo file could not be read: %s.", err)
+		}
+
+		annotated = []byte(annotateTodoFile(string(content), err))
+
+		if err := os.WriteFile(path, annotated, 0600); err != nil {
+			return todo, err
+		}
+	}
+}
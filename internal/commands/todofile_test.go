@@ -0,0 +1,207 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/streed/cli-do-client/clidotest"
+)
+
+func TestTodoFileRoundTrip(t *testing.T) {
+	var dueDate = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var todo = clido.Todo{Ticket: 12, ETag: `"a1b2"`, Subject: "Fix: #42 \"quotes\"", Completed: true, DueDate: &dueDate, Body: "Line one\n\n---\nLine two\n"}
+
+	content, err := FormatTodoFile(todo)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(content, "---\n# Ticket 12\n") {
+		t.Fatalf("expected front matter with the ticket, got %q", content)
+	}
+
+	parsed, err := ParseTodoFile(clido.Todo{Ticket: 12, ETag: `"a1b2"`}, content)
+
+	if err != nil {
+		t.Fatalf("parse %q: %v", content, err)
+	}
+
+	if parsed.Subject != todo.Subject || !parsed.Completed || parsed.DueDate == nil || !parsed.DueDate.Equal(dueDate) || parsed.Body != "Line one\n\n---\nLine two" || parsed.ETag != `"a1b2"` {
+		t.Fatalf("unexpected todo %+v from %q", parsed, content)
+	}
+}
+
+func TestParseTodoFileErrors(t *testing.T) {
+	var cases = map[string]string{
+		"":                                  "must start with a --- line",
+		"subject: Buy milk\n":               "must start with a --- line",
+		"---\nsubject: Buy milk\n":          "not closed",
+		"---\nsubject: [Buy\n---\n":         "not valid YAML",
+		"---\ncompleted: false\n---\nOat\n": "subject must not be empty",
+		"---\nsubject: \"\"\n---\nOat\n":    "subject must not be empty",
+		"---\nsubject: Buy milk\ncompleted: yes\n---\n": "completed must be true or false",
+		"---\nsubject: Buy milk\ndue_date: soon\n---\n": "due_date must be a date",
+		"---\nsubject: Buy milk\npriority: 1\n---\n":    "unknown field \"priority\"",
+		"---\nsubject: Buy milk\n---\n<<<<<<< mine\n":   "conflict markers",
+	}
+
+	for content, want := range cases {
+		if _, err := ParseTodoFile(clido.Todo{}, content); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want an error containing %q", content, err, want)
+		}
+	}
+
+	for _, content := range []string{"---\nsubject: \"\"\n---\n", "---\ncompleted: false\ndue_date: none\n---\n\n\n"} {
+		if _, err := ParseTodoFile(clido.Todo{}, content); !errors.Is(err, errEditCancelled) {
+			t.Errorf("%q: got %v, want errEditCancelled for a todo with neither subject nor body", content, err)
+		}
+	}
+
+	todo, err := ParseTodoFile(clido.Todo{}, "# A note\n\n---\nsubject: Buy milk\ndue_date: none\n---\n")
+
+	if err != nil || todo.Subject != "Buy milk" || todo.DueDate != nil || todo.Body != "" {
+		t.Fatalf("expected comments above the front matter to be ignored, got %+v, %v", todo, err)
+	}
+}
+
+func TestHandleEditTodoReopensInvalidFile(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	// The first pass writes a bad date, the second fixes it once the error is
+	// noted at the top of the file.
+	var editor = filepath.Join(t.TempDir(), "editor.sh")
+	var script = "#!/bin/sh\n" +
+		"if grep -q '^# The todo could not be saved' \"$1\"; then\n" +
+		"  grep -q 'due_date must be a date' \"$1\" && sed -i 's/due_date: .*/due_date: 2024-05-01/' \"$1\"\n" +
+		"else\n" +
+		"  sed -i 's/due_date: .*/due_date: next week/' \"$1\"\n" +
+		"fi\n"
+
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("EDITOR", editor)
+
+	if _, err := run(t, "-p", project.Id, "todo", "edit", "1"); err != nil {
+		t.Fatalf("todo edit: %v", err)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); todo.DueDate == nil || todo.DueDate.Format("2006-01-02") != "2024-05-01" {
+		t.Fatalf("expected the fixed due date, got %+v", todo)
+	}
+
+	// An editor that leaves the annotated file as it is gives up.
+	script = "#!/bin/sh\ngrep -q '^# The todo' \"$1\" || sed -i 's/completed: .*/completed: maybe/' \"$1\"\n"
+
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "-p", project.Id, "todo", "edit", "1"); ExitCode(err) != ExitUsage {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitUsage)
+	}
+
+	if leftovers := todoFiles(); len(leftovers) != 1 {
+		t.Fatalf("expected the edited file to be kept, found %v", leftovers)
+	}
+}
+
+func TestHandleEditTodoCancel(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+	_, _ = server.AddTodo(project.Id, clidotest.Todo{Subject: "Buy milk"})
+
+	var editor = filepath.Join(t.TempDir(), "editor.sh")
+
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\n: > \"$1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("EDITOR", editor)
+	var requests = server.Requests()
+
+	if _, err := run(t, "-p", project.Id, "todo", "edit", "1"); err != nil {
+		t.Fatalf("todo edit: %v", err)
+	}
+
+	if todo, _ := server.Todo(project.Id, 1); todo.Subject != "Buy milk" || server.Requests() != requests+1 {
+		t.Fatalf("expected nothing to be sent, got %+v", todo)
+	}
+
+	if leftovers := todoFiles(); len(leftovers) != 0 {
+		t.Fatalf("expected the file to be removed, found %v", leftovers)
+	}
+}
+
+func TestHandleCreateTodoInEditor(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	var editor = filepath.Join(t.TempDir(), "editor.sh")
+	var script = "#!/bin/sh\nsed -i 's/subject: .*/subject: Plan the offsite/' \"$1\"\nprintf 'Venue\\n\\nAgenda\\n' >> \"$1\"\n"
+
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("VISUAL", editor)
+
+	if _, err := run(t, "-p", project.Id, "todo", "new", "--due-date", "2030-01-02"); err != nil {
+		t.Fatalf("todo new: %v", err)
+	}
+
+	todo, ok := server.Todo(project.Id, 1)
+
+	if !ok || todo.Subject != "Plan the offsite" || todo.Body != "Venue\n\nAgenda" || todo.DueDate == nil || todo.DueDate.Format("2006-01-02") != "2030-01-02" {
+		t.Fatalf("unexpected todo %+v", todo)
+	}
+
+	// --edit opens the editor even with a subject, starting from it.
+	script = "#!/bin/sh\nsed -i 's/subject: Buy milk/subject: Buy oat milk/' \"$1\"\n"
+
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, "-p", project.Id, "todo", "new", "--subject", "Buy milk", "--edit"); err != nil {
+		t.Fatalf("todo new --edit: %v", err)
+	}
+
+	if todo, _ := server.Todo(project.Id, 2); todo.Subject != "Buy oat milk" {
+		t.Fatalf("unexpected todo %+v", todo)
+	}
+
+	if leftovers := todoFiles(); len(leftovers) != 0 {
+		t.Fatalf("expected the file to be removed, found %v", leftovers)
+	}
+}
+
+func TestHandleCreateTodoAbortsWhenEmpty(t *testing.T) {
+	var server = setup(t)
+	var project = server.AddProject("Inbox", "")
+
+	// Closing the editor on the template leaves the subject empty.
+	t.Setenv("EDITOR", "true")
+
+	// Like git commit, aborting is a failure but not a usage error.
+	if _, err := run(t, "-p", project.Id, "todo", "new"); ExitCode(err) != ExitError || !strings.Contains(err.Error(), "aborting") {
+		t.Fatalf("got exit code %d for %v, want %d", ExitCode(err), err, ExitError)
+	}
+
+	if _, ok := server.Todo(project.Id, 1); ok {
+		t.Fatal("expected no todo to be created")
+	}
+
+	if leftovers := todoFiles(); len(leftovers) != 0 {
+		t.Fatalf("expected the file to be removed, found %v", leftovers)
+	}
+}
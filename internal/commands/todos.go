@@ -0,0 +1,473 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aquilax/truncate"
+	"github.com/rodaine/table"
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// Orders accepted by 'todo list --sort'.
+const (
+	SortDue     = "due"
+	SortTicket  = "ticket"
+	SortSubject = "subject"
+)
+
+func HandleTodosList(ctx *cli.Context) error {
+	if ctx.Bool("all-projects") {
+		if ctx.IsSet("sort") {
+			return NewUsageError("--sort cannot be combined with --all-projects, which orders todos by due date.")
+		}
+
+		return HandleAgenda(ctx)
+	}
+
+	query, err := TodoQueryFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projectId, err := RequireProjectId(ctx, api)
+
+	if err != nil {
+		return err
+	}
+
+	todos, err := api.QueryTodos(ctx.Context, projectId, query)
+
+	if err != nil {
+		return err
+	}
+
+	var filtered = FilterTodos(todos.Todos, query, time.Now())
+
+	if err := SortTodos(filtered, todoSort(ctx), ctx.Bool("reverse")); err != nil {
+		return err
+	}
+
+	return TodosOutput(filtered).Render(ctx)
+}
+
+// TodoQueryFromContext builds the list filters from the flags. --all and
+// --sort default to the filters of the project file.
+func TodoQueryFromContext(ctx *cli.Context) (clido.TodoQuery, error) {
+	var query = clido.TodoQuery{
+		All:       ctx.Bool("all"),
+		Overdue:   ctx.Bool("overdue"),
+		DueBefore: ctx.Timestamp("due-before"),
+		DueAfter:  ctx.Timestamp("due-after"),
+		Text:      ctx.String("grep"),
+	}
+
+	if ctx.Bool("completed") {
+		var completed = true
+		query.Completed = &completed
+	}
+
+	if !ctx.IsSet("all") {
+		directorySettings, err := LoadDirectorySettings()
+
+		if err != nil {
+			return query, err
+		}
+
+		query.All = directorySettings.Filters.All
+	}
+
+	if query.DueBefore != nil && query.DueAfter != nil && !query.DueAfter.Before(*query.DueBefore) {
+		return query, NewUsageError("--due-after must be earlier than --due-before.")
+	}
+
+	return query, nil
+}
+
+func todoSort(ctx *cli.Context) string {
+	if ctx.IsSet("sort") {
+		return ctx.String("sort")
+	}
+
+	directorySettings, err := LoadDirectorySettings()
+
+	if err != nil {
+		return ""
+	}
+
+	return directorySettings.Filters.Sort
+}
+
+// FilterTodos keeps the todos matching query, for the filters the server
+// did not apply.
+func FilterTodos(todos []clido.Todo, query clido.TodoQuery, now time.Time) []clido.Todo {
+	var filtered = []clido.Todo{}
+
+	for _, todo := range todos {
+		if query.Matches(todo, now) {
+			filtered = append(filtered, todo)
+		}
+	}
+
+	return filtered
+}
+
+// SortTodos orders todos by due date, ticket or subject. Todos without a due
+// date sort last; ties keep ticket order. An empty order leaves the server's.
+func SortTodos(todos []clido.Todo, by string, reverse bool) error {
+	var less func(a clido.Todo, b clido.Todo) bool
+
+	switch by {
+	case "":
+		return nil
+	case SortDue:
+		less = func(a clido.Todo, b clido.Todo) bool {
+			if a.DueDate == nil || b.DueDate == nil {
+				return a.DueDate != nil && b.DueDate == nil
+			}
+
+			return a.DueDate.Before(*b.DueDate)
+		}
+	case SortTicket:
+		less = func(a clido.Todo, b clido.Todo) bool { return a.Ticket < b.Ticket }
+	case SortSubject:
+		less = func(a clido.Todo, b clido.Todo) bool {
+			return strings.ToLower(a.Subject) < strings.ToLower(b.Subject)
+		}
+	default:
+		return NewUsageError("Unknown sort order %q. Use due, ticket or subject.", by)
+	}
+
+	sort.SliceStable(todos, func(i, j int) bool {
+		return less(todos[i], todos[j])
+	})
+
+	if reverse {
+		for i, j := 0, len(todos)-1; i < j; i, j = i+1, j-1 {
+			todos[i], todos[j] = todos[j], todos[i]
+		}
+	}
+
+	return nil
+}
+
+func TodosOutput(todos []clido.Todo) Output {
+	var items = make([]interface{}, 0, len(todos))
+
+	for _, todo := range todos {
+		items = append(items, todo)
+	}
+
+	if todos == nil {
+		todos = []clido.Todo{}
+	}
+
+	return Output{
+		Value:   todos,
+		Items:   items,
+		Columns: TodoColumns(),
+		Record:  TodoRecord,
+		Table: func(w io.Writer) {
+			PrintTodosTable(w, todos)
+		},
+	}
+}
+
+func PrintTodosTable(w io.Writer, todos []clido.Todo) {
+	var tbl = table.New("Ticket", "Subject", "Body", "Due Date", "Completed", "Past Due").WithWriter(w)
+
+	for _, todo := range todos {
+		var dueDate string
+		if todo.DueDate == nil {
+			dueDate = "-"
+		} else {
+			dueDate = todo.DueDate.String()
+		}
+		var trunacatedSubject = truncate.Truncate(todo.Subject, 24, "...", truncate.PositionEnd)
+		var truncatedBody = truncate.Truncate(todo.Body, 32, "...", truncate.PositionEnd)
+		tbl.AddRow(todo.Ticket, trunacatedSubject, truncatedBody, dueDate, todo.Completed, todo.PastDue)
+	}
+
+	tbl.Print()
+}
+
+func HandleGetTodo(ctx *cli.Context) error {
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projectId, ticket, err := RequireTodoRef(ctx, api)
+
+	if err != nil {
+		return err
+	}
+
+	todo, err := api.GetTodo(ctx.Context, projectId, ticket)
+
+	if freshId, ok := refreshTodoRef(ctx, api, projectId, err); ok {
+		projectId = freshId
+		todo, err = api.GetTodo(ctx.Context, projectId, ticket)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return TodoOutput(todo).Render(ctx)
+}
+
+func TodoOutput(todo clido.Todo) Output {
+	return Output{
+		Value:   todo,
+		Items:   []interface{}{todo},
+		Columns: TodoColumns(),
+		Record:  TodoRecord,
+		Table: func(w io.Writer) {
+			PrintTodo(w, todo)
+		},
+	}
+}
+
+func PrintTodo(w io.Writer, todo clido.Todo) {
+	fmt.Fprintln(w, "Ticket:", todo.Ticket)
+	if todo.DueDate != nil {
+		fmt.Fprintln(w, "Due Date:", todo.DueDate.Format("2006-01-02"))
+	}
+	fmt.Fprintln(w, "Completed:", todo.Completed)
+	fmt.Fprintln(w, "Subject:", todo.Subject)
+	fmt.Fprintf(w, "\n%s\n", todo.Body)
+}
+
+// HandleEditTodo opens a todo in $EDITOR and saves the result. The todo is
+// read from the server rather than the cache, and if someone else changed it
+// in the meantime, the server refuses the update and the user chooses how to
+// combine the two versions.
+func HandleEditTodo(ctx *cli.Context) error {
+	api, err := newCachedApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projectId, ticket, err := RequireTodoRef(ctx, api)
+
+	if err != nil {
+		return err
+	}
+
+	todo, err := api.GetFreshTodo(ctx.Context, projectId, ticket)
+
+	if freshId, ok := refreshTodoRef(ctx, api, projectId, err); ok {
+		projectId = freshId
+		todo, err = api.GetFreshTodo(ctx.Context, projectId, ticket)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var path string
+	path, err = WriteToTempFile(todo)
+
+	if err != nil {
+		return err
+	}
+
+	updatedTodo, err := EditTodoFile(todo, path)
+
+	if err == nil && sameTodoFile(todo, updatedTodo) {
+		_ = os.Remove(path)
+		fmt.Fprintln(ctx.App.Writer, "No changes.")
+		return nil
+	}
+
+	var reader = bufio.NewReader(ctx.App.Reader)
+
+	for err == nil {
+		err = api.UpdateTodo(ctx.Context, projectId, ticket, clido.UpdateTodo{Todo: updatedTodo})
+
+		if !errors.Is(err, clido.ErrConflict) {
+			break
+		}
+
+		theirs, getErr := api.GetFreshTodo(ctx.Context, projectId, ticket)
+
+		if getErr != nil {
+			err = getErr
+			break
+		}
+
+		updatedTodo, err = resolveEditConflict(ctx, reader, path, err, todo, theirs, updatedTodo)
+		todo = theirs
+	}
+
+	if errors.Is(err, errEditCancelled) {
+		_ = os.Remove(path)
+		fmt.Fprintln(ctx.App.Writer, "Edit cancelled, the todo was not changed.")
+		return nil
+	}
+
+	if reportQueued(ctx.App.Writer, err) {
+		_ = os.Remove(path)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w\nYour changes are kept in %s", err, path)
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Todo updated successfully!")
+
+	_ = os.Remove(path)
+
+	return nil
+}
+
+// HandleCreateTodo creates a todo from the flags. Without --subject, or with
+// --edit, the todo is composed in $VISUAL or $EDITOR first, starting from the
+// flags given; leaving the file empty aborts, like git commit does.
+func HandleCreateTodo(ctx *cli.Context) error {
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projectId, err := RequireProjectId(ctx, api)
+
+	if err != nil {
+		return err
+	}
+
+	var createTodo = clido.CreateTodo{
+		Todo: clido.Todo{
+			Subject: ctx.String("subject"),
+			Body:    ctx.String("body"),
+			DueDate: ctx.Timestamp("due-date"),
+		},
+	}
+
+	var path string
+
+	if createTodo.Todo.Subject == "" || ctx.Bool("edit") {
+		path, err = WriteToTempFile(createTodo.Todo)
+
+		if err != nil {
+			return err
+		}
+
+		createTodo.Todo, err = EditTodoFile(createTodo.Todo, path)
+
+		if errors.Is(err, errEditCancelled) {
+			_ = os.Remove(path)
+			return errors.New("aborting, the todo file was left empty")
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w\nYour todo is kept in %s", err, path)
+		}
+	}
+
+	todo, err := api.CreateTodo(ctx.Context, projectId, createTodo)
+	var queued = reportQueued(ctx.App.Writer, err)
+
+	if err != nil && !queued {
+		if path != "" {
+			return fmt.Errorf("%w\nYour todo is kept in %s", err, path)
+		}
+
+		return err
+	}
+
+	if path != "" {
+		_ = os.Remove(path)
+	}
+
+	if queued {
+		return nil
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "Todo created successfully with ticket: %d\n", todo.Ticket)
+
+	return nil
+}
+
+func HandleArchiveTodo(ctx *cli.Context) error {
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projectId, ticket, err := RequireTodoRef(ctx, api)
+
+	if err != nil {
+		return err
+	}
+
+	err = api.ArchiveTodo(ctx.Context, projectId, ticket)
+
+	if freshId, ok := refreshTodoRef(ctx, api, projectId, err); ok {
+		err = api.ArchiveTodo(ctx.Context, freshId, ticket)
+	}
+
+	if reportQueued(ctx.App.Writer, err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Todo archived successfully!")
+
+	return nil
+}
+
+func HandleCompleteTodo(ctx *cli.Context) error {
+	api, err := NewApiFromContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	projectId, ticket, err := RequireTodoRef(ctx, api)
+
+	if err != nil {
+		return err
+	}
+
+	err = api.CompleteTodo(ctx.Context, projectId, ticket)
+
+	if freshId, ok := refreshTodoRef(ctx, api, projectId, err); ok {
+		err = api.CompleteTodo(ctx.Context, freshId, ticket)
+	}
+
+	if reportQueued(ctx.App.Writer, err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Todo completed successfully!")
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/streed/cli-do-client/clido"
+	"github.com/urfave/cli/v2"
+)
+
+// ProjectSettingsFile is the file 'project init' writes to tie a directory,
+// and everything below it, to a project.
+const ProjectSettingsFile = ".cli-do-project"
+
+// Where the search for ProjectSettingsFile stops instead of $HOME, set with
+// CLI_DO_PROJECT_BOUNDARY.
+const (
+	ProjectBoundaryGit  = "git"
+	ProjectBoundaryRoot = "root"
+)
+
+// DirectorySettings is the content of a project file. Besides the project it
+// can set the profile, the output format and the default todo filters for
+// commands run below it; config keys such as timeout are read by LoadConfig,
+// which refuses an endpoint or client_id other than the profile's.
+type DirectorySettings struct {
+	ProjectId string      `json:"project_id"`
+	Profile   string      `json:"profile,omitempty"`
+	Output    string      `json:"output,omitempty"`
+	Format    string      `json:"format,omitempty"`
+	Filters   TodoFilters `json:"filters,omitempty"`
+	Path      string      `json:"-"`
+}
+
+// TodoFilters are the defaults for 'todo list' in a project directory.
+type TodoFilters struct {
+	All  bool   `json:"all,omitempty"`
+	Sort string `json:"sort,omitempty"`
+}
+
+// ReadDirectorySettingsFile returns the settings of the nearest project file,
+// with --project taking precedence over its project_id.
+func ReadDirectorySettingsFile(ctx *cli.Context) (DirectorySettings, error) {
+	directorySettings, err := LoadDirectorySettings()
+
+	if err != nil {
+		return directorySettings, err
+	}
+
+	if directorySettings.Path != "" && ctx.Bool("verbose") {
+		fmt.Fprintf(ctx.App.ErrWriter, "Using project settings from %s\n", directorySettings.Path)
+	}
+
+	if project := ctx.String("project"); project != "" {
+		directorySettings.ProjectId = project
+	}
+
+	return directorySettings, nil
+}
+
+// LoadDirectorySettings reads the nearest project file, returning empty
+// settings when there is none.
+func LoadDirectorySettings() (DirectorySettings, error) {
+	var directorySettings DirectorySettings
+	var path = FindDirectorySettingsFile()
+
+	if path == "" {
+		return directorySettings, nil
+	}
+
+	byteValue, err := os.ReadFile(path)
+
+	if err != nil {
+		return directorySettings, err
+	}
+
+	if err := json.Unmarshal(byteValue, &directorySettings); err != nil {
+		return directorySettings, NewUsageError("Unable to parse %s: %s", path, err)
+	}
+
+	directorySettings.Path = path
+
+	return directorySettings, nil
+}
+
+// FindDirectorySettingsFile walks up from the working directory to the
+// nearest project file, like git does for .git, and returns "" when there is
+// none. The search stops at $HOME, or at the root of the enclosing git
+// repository when CLI_DO_PROJECT_BOUNDARY is git, and goes on to / when it is
+// root.
+func FindDirectorySettingsFile() string {
+	dir, err := os.Getwd()
+
+	if err != nil {
+		return ""
+	}
+
+	var stop = projectBoundary(dir)
+
+	for {
+		var path = filepath.Join(dir, ProjectSettingsFile)
+
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+
+		var parent = filepath.Dir(dir)
+
+		if dir == stop || parent == dir {
+			return ""
+		}
+
+		dir = parent
+	}
+}
+
+// projectBoundary returns the last directory searched from dir, or "" to
+// search up to the filesystem root.
+func projectBoundary(dir string) string {
+	switch os.Getenv("CLI_DO_PROJECT_BOUNDARY") {
+	case ProjectBoundaryRoot:
+		return ""
+	case ProjectBoundaryGit:
+		for current := dir; ; current = filepath.Dir(current) {
+			if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+				return current
+			}
+
+			if filepath.Dir(current) == current {
+				break
+			}
+		}
+	}
+
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return ""
+	}
+
+	if relative, err := filepath.Rel(homeDir, dir); err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return ""
+	}
+
+	return homeDir
+}
+
+// RequireProjectId resolves --project, or the project file's project_id, to
+// the Id of a project. Both accept anything ResolveProjectId does.
+func RequireProjectId(ctx *cli.Context, api clido.Api) (string, error) {
+	directorySettings, err := ReadDirectorySettingsFile(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if directorySettings.ProjectId == "" {
+		return "", NewUsageError("Project flag not provided and project directory not initialized.")
+	}
+
+	return ResolveProjectId(ctx.Context, api, directorySettings.ProjectId)
+}
+
+// todoRefRegex matches global todo references such as PROJ-42.
+var todoRefRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9]*)-([0-9]+)$`)
+
+// RequireTodoRef returns the project and ticket of the todo named by the
+// first argument: a global reference such as PROJ-42, which works from any
+// directory, or a bare ticket in the project from --project or the project
+// file.
+func RequireTodoRef(ctx *cli.Context, api clido.Api) (string, string, error) {
+	ticket, err := RequireTicket(ctx)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if matches := todoRefRegex.FindStringSubmatch(ticket); matches != nil {
+		projectId, err := ResolveProjectKey(ctx, api, matches[1])
+
+		return projectId, matches[2], err
+	}
+
+	projectId, err := RequireProjectId(ctx, api)
+
+	return projectId, ticket, err
+}
+
+// refreshTodoRef handles err from the first request made for the todo named
+// by the first argument. When the server answered 404 for a KEY-TICKET
+// reference, the key may be cached for a project that was archived or
+// deleted since, so the key cache is refreshed from the server once. It
+// returns the project the key now names, and false when it names the same
+// one or no project at all.
+func refreshTodoRef(ctx *cli.Context, api clido.Api, projectId string, err error) (string, bool) {
+	var matches = todoRefRegex.FindStringSubmatch(ctx.Args().First())
+
+	if matches == nil || !errors.Is(err, clido.ErrNotFound) {
+		return "", false
+	}
+
+	profile, err := ActiveProfile(ctx)
+
+	if err != nil {
+		return "", false
+	}
+
+	if cachedApi, ok := api.(*CachedApi); ok {
+		api = cachedApi.Api
+	}
+
+	projects, err := api.GetProjects(ctx.Context)
+
+	if err != nil {
+		return "", false
+	}
+
+	freshId, ok := cacheProjectKeys(profile, projects.Projects)[strings.ToUpper(matches[1])]
+
+	return freshId, ok && freshId != projectId
+}
+
+func RequireTicket(ctx *cli.Context) (string, error) {
+	var ticket = ctx.Args().First()
+
+	if ticket == "" {
+		return "", NewUsageError("A todo ticket or reference such as PROJ-42 is required.")
+	}
+
+	return ticket, nil
+}
@@ -0,0 +1,127 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenSaved
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	pos   int
+	upper string
+}
+
+var operators = []string{"<=", ">=", "!=", "!~", "=", "<", ">", "~"}
+
+// lex splits input into words, quoted strings, operators, parentheses and
+// @saved references. Positions are byte offsets, reported in errors.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	var i = 0
+
+	for i < len(input) {
+		var c = rune(input[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == '"' || c == '\'':
+			var builder strings.Builder
+			var start = i
+			i++
+
+			for {
+				if i >= len(input) {
+					return nil, &SyntaxError{Pos: start, Message: "unterminated string"}
+				}
+
+				if input[i] == '\\' && i+1 < len(input) {
+					builder.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+
+				if rune(input[i]) == c {
+					i++
+					break
+				}
+
+				builder.WriteByte(input[i])
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: builder.String(), pos: start})
+		case c == '@':
+			var start = i
+			i++
+
+			for i < len(input) && isWordByte(input[i]) {
+				i++
+			}
+
+			if i == start+1 {
+				return nil, &SyntaxError{Pos: start, Message: "expected a saved query name after @"}
+			}
+
+			tokens = append(tokens, token{kind: tokenSaved, text: input[start+1 : i], pos: start})
+		default:
+			if operator := matchOperator(input[i:]); operator != "" {
+				tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: i})
+				i += len(operator)
+				continue
+			}
+
+			if !isWordByte(input[i]) {
+				return nil, &SyntaxError{Pos: i, Message: fmt.Sprintf("unexpected %q", input[i])}
+			}
+
+			var start = i
+
+			for i < len(input) && isWordByte(input[i]) {
+				i++
+			}
+
+			var text = input[start:i]
+			tokens = append(tokens, token{kind: tokenWord, text: text, pos: start, upper: strings.ToUpper(text)})
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
+
+func matchOperator(input string) string {
+	for _, operator := range operators {
+		if strings.HasPrefix(input, operator) {
+			return operator
+		}
+	}
+
+	return ""
+}
+
+// isWordByte accepts the characters of field names, numbers, dates such as
+// 2026-11-01 and relative dates such as -3d.
+func isWordByte(b byte) bool {
+	return b == '_' || b == '-' || b == '.' || b == '+' ||
+		(b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
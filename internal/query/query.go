@@ -0,0 +1,540 @@
+// Package query implements the todo search language used by
+// 'cli-do todo search':
+//
+//	due<7d AND NOT completed AND subject~"release"
+//	(project=ops OR project=web) AND @mine
+//
+// Comparisons are joined with AND, OR and NOT and grouped with parentheses.
+// @name expands to a saved query.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+)
+
+// Expr is a parsed query. Relative dates are resolved against now when it is
+// evaluated.
+type Expr interface {
+	Eval(todo clido.Todo, project clido.Project, now time.Time) bool
+	String() string
+}
+
+type SyntaxError struct {
+	Pos     int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Pos+1)
+}
+
+type kind int
+
+const (
+	kindInt kind = iota
+	kindString
+	kindDate
+	kindBool
+)
+
+// fields maps each searchable field to its type. due is short for due_date.
+var fields = map[string]kind{
+	"ticket":    kindInt,
+	"subject":   kindString,
+	"body":      kindString,
+	"project":   kindString,
+	"due_date":  kindDate,
+	"due":       kindDate,
+	"completed": kindBool,
+	"past_due":  kindBool,
+}
+
+var operatorsByKind = map[kind][]string{
+	kindInt:    {"=", "!=", "<", "<=", ">", ">="},
+	kindString: {"=", "!=", "~", "!~"},
+	kindDate:   {"=", "!=", "<", "<=", ">", ">="},
+	kindBool:   {"=", "!="},
+}
+
+// Fields returns the names usable in a query.
+func Fields() []string {
+	var names = make([]string, 0, len(fields))
+
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Parse reads input. saved holds the named queries @name may refer to.
+func Parse(input string, saved map[string]string) (Expr, error) {
+	var p = &parser{saved: saved}
+
+	return p.parse(input)
+}
+
+type parser struct {
+	saved     map[string]string
+	expanding []string
+	tokens    []token
+	next      int
+}
+
+func (p *parser) parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 1 {
+		return nil, &SyntaxError{Pos: 0, Message: "empty query"}
+	}
+
+	var outer = *p
+	p.tokens = tokens
+	p.next = 0
+
+	expr, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Message: fmt.Sprintf("unexpected %q, expected AND, OR or the end of the query", tok.text)}
+	}
+
+	p.tokens, p.next = outer.tokens, outer.next
+
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	var tok = p.tokens[p.next]
+
+	if tok.kind != tokenEOF {
+		p.next++
+	}
+
+	return tok
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	var tok = p.peek()
+
+	return tok.kind == tokenWord && tok.upper == keyword
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("OR") {
+		p.advance()
+
+		right, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = Or{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("AND") {
+		p.advance()
+
+		right, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = And{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.isKeyword("NOT") {
+		p.advance()
+
+		expr, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return Not{Expr: expr}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	var tok = p.advance()
+
+	switch tok.kind {
+	case tokenLParen:
+		expr, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.advance(); closing.kind != tokenRParen {
+			return nil, &SyntaxError{Pos: closing.pos, Message: "expected )"}
+		}
+
+		return expr, nil
+	case tokenSaved:
+		return p.expand(tok)
+	case tokenWord:
+		return p.parseComparison(tok)
+	case tokenEOF:
+		return nil, &SyntaxError{Pos: tok.pos, Message: "unexpected end of query"}
+	}
+
+	return nil, &SyntaxError{Pos: tok.pos, Message: fmt.Sprintf("unexpected %q, expected a field, NOT, ( or @name", tok.text)}
+}
+
+func (p *parser) expand(tok token) (Expr, error) {
+	text, ok := p.saved[tok.text]
+
+	if !ok {
+		return nil, &SyntaxError{Pos: tok.pos, Message: fmt.Sprintf("no saved query named %q", tok.text)}
+	}
+
+	for _, name := range p.expanding {
+		if name == tok.text {
+			return nil, &SyntaxError{Pos: tok.pos, Message: fmt.Sprintf("saved query %q refers to itself", tok.text)}
+		}
+	}
+
+	p.expanding = append(p.expanding, tok.text)
+	defer func() { p.expanding = p.expanding[:len(p.expanding)-1] }()
+
+	expr, err := p.parse(text)
+
+	if err != nil {
+		return nil, fmt.Errorf("in saved query @%s: %w", tok.text, err)
+	}
+
+	return Saved{Name: tok.text, Expr: expr}, nil
+}
+
+func (p *parser) parseComparison(field token) (Expr, error) {
+	var name = strings.ToLower(field.text)
+	fieldKind, ok := fields[name]
+
+	if !ok {
+		return nil, &SyntaxError{Pos: field.pos, Message: fmt.Sprintf("unknown field %q, expected one of %s", field.text, strings.Join(Fields(), ", "))}
+	}
+
+	if name == "due" {
+		name = "due_date"
+	}
+
+	var operator = p.peek()
+
+	// A bare boolean field such as 'completed' means completed=true.
+	if fieldKind == kindBool && operator.kind != tokenOperator {
+		return Comparison{Field: name, Op: "=", Value: value{kind: kindBool, boolean: true, text: "true"}}, nil
+	}
+
+	if operator.kind != tokenOperator {
+		return nil, &SyntaxError{Pos: operator.pos, Message: fmt.Sprintf("expected an operator after %s", field.text)}
+	}
+
+	p.advance()
+
+	if !contains(operatorsByKind[fieldKind], operator.text) {
+		return nil, &SyntaxError{Pos: operator.pos, Message: fmt.Sprintf("%s does not support %s, use one of %s", name, operator.text, strings.Join(operatorsByKind[fieldKind], " "))}
+	}
+
+	var literal = p.advance()
+
+	if literal.kind != tokenWord && literal.kind != tokenString {
+		return nil, &SyntaxError{Pos: literal.pos, Message: fmt.Sprintf("expected a value after %s%s", field.text, operator.text)}
+	}
+
+	parsed, err := parseValue(fieldKind, literal.text)
+
+	if err != nil {
+		return nil, &SyntaxError{Pos: literal.pos, Message: fmt.Sprintf("invalid value for %s: %s", name, err)}
+	}
+
+	if parsed.none && operator.text != "=" && operator.text != "!=" {
+		return nil, &SyntaxError{Pos: literal.pos, Message: "none can only be compared with = or !="}
+	}
+
+	return Comparison{Field: name, Op: operator.text, Value: parsed}, nil
+}
+
+// value is a literal checked against the type of its field.
+type value struct {
+	kind    kind
+	text    string
+	number  int
+	boolean bool
+	// Dates are either absolute or a number of days, weeks, months or years
+	// from today. none matches todos without a due date.
+	date   *time.Time
+	offset int
+	unit   byte
+	none   bool
+}
+
+var relativeDateRegex = regexp.MustCompile(`^([+-]?\d+)([dwmy])$`)
+
+func parseValue(fieldKind kind, text string) (value, error) {
+	var v = value{kind: fieldKind, text: text}
+
+	switch fieldKind {
+	case kindInt:
+		number, err := strconv.Atoi(text)
+
+		if err != nil {
+			return v, fmt.Errorf("%q is not a whole number", text)
+		}
+
+		v.number = number
+	case kindBool:
+		switch strings.ToLower(text) {
+		case "true", "yes":
+			v.boolean = true
+		case "false", "no":
+			v.boolean = false
+		default:
+			return v, fmt.Errorf("%q is not true or false", text)
+		}
+	case kindDate:
+		switch strings.ToLower(text) {
+		case "none":
+			v.none = true
+		case "today":
+			v.unit = 'd'
+		case "tomorrow":
+			v.unit, v.offset = 'd', 1
+		case "yesterday":
+			v.unit, v.offset = 'd', -1
+		default:
+			if matches := relativeDateRegex.FindStringSubmatch(text); matches != nil {
+				v.offset, _ = strconv.Atoi(matches[1])
+				v.unit = matches[2][0]
+
+				break
+			}
+
+			date, err := time.Parse("2006-01-02", text)
+
+			if err != nil {
+				return v, fmt.Errorf("%q is not a date, use YYYY-MM-DD, today, tomorrow, yesterday, none or an offset such as 7d, 2w, -1m", text)
+			}
+
+			v.date = &date
+		}
+	}
+
+	return v, nil
+}
+
+// resolve returns the calendar day a date value stands for.
+func (v value) resolve(now time.Time) time.Time {
+	if v.date != nil {
+		return clido.Day(*v.date)
+	}
+
+	var today = clido.Day(now)
+
+	switch v.unit {
+	case 'w':
+		return today.AddDate(0, 0, 7*v.offset)
+	case 'm':
+		return today.AddDate(0, v.offset, 0)
+	case 'y':
+		return today.AddDate(v.offset, 0, 0)
+	}
+
+	return today.AddDate(0, 0, v.offset)
+}
+
+func (v value) String() string {
+	if v.kind == kindString {
+		return strconv.Quote(v.text)
+	}
+
+	return v.text
+}
+
+type Comparison struct {
+	Field string
+	Op    string
+	Value value
+}
+
+func (c Comparison) Eval(todo clido.Todo, project clido.Project, now time.Time) bool {
+	switch c.Field {
+	case "ticket":
+		return compareOrdered(todo.Ticket-c.Value.number, c.Op)
+	case "subject":
+		return compareText([]string{todo.Subject}, c.Op, c.Value.text)
+	case "body":
+		return compareText([]string{todo.Body}, c.Op, c.Value.text)
+	case "project":
+		return compareText([]string{project.Name, project.Key}, c.Op, c.Value.text)
+	case "completed":
+		return (todo.Completed == c.Value.boolean) == (c.Op == "=")
+	case "past_due":
+		return (todo.IsOverdue(now) == c.Value.boolean) == (c.Op == "=")
+	case "due_date":
+		if c.Value.none {
+			return (todo.DueDate == nil) == (c.Op == "=")
+		}
+
+		// Todos without a due date are only unequal to every date.
+		if todo.DueDate == nil {
+			return c.Op == "!="
+		}
+
+		return compareOrdered(clido.Day(*todo.DueDate).Compare(c.Value.resolve(now)), c.Op)
+	}
+
+	return false
+}
+
+func (c Comparison) String() string {
+	return c.Field + c.Op + c.Value.String()
+}
+
+// compareOrdered applies op to the sign of a comparison.
+func compareOrdered(sign int, op string) bool {
+	switch op {
+	case "=":
+		return sign == 0
+	case "!=":
+		return sign != 0
+	case "<":
+		return sign < 0
+	case "<=":
+		return sign <= 0
+	case ">":
+		return sign > 0
+	case ">=":
+		return sign >= 0
+	}
+
+	return false
+}
+
+// compareText matches when any of candidates does: = is equality and ~ a
+// substring test, both ignoring case. The negated operators match when none
+// of candidates does.
+func compareText(candidates []string, op string, text string) bool {
+	var match = false
+
+	for _, candidate := range candidates {
+		if op == "=" || op == "!=" {
+			match = match || (candidate != "" && strings.EqualFold(candidate, text))
+		} else {
+			match = match || strings.Contains(strings.ToLower(candidate), strings.ToLower(text))
+		}
+	}
+
+	if op == "!=" || op == "!~" {
+		return !match
+	}
+
+	return match
+}
+
+type And struct {
+	Left  Expr
+	Right Expr
+}
+
+func (e And) Eval(todo clido.Todo, project clido.Project, now time.Time) bool {
+	return e.Left.Eval(todo, project, now) && e.Right.Eval(todo, project, now)
+}
+
+func (e And) String() string {
+	return fmt.Sprintf("(%s AND %s)", e.Left, e.Right)
+}
+
+type Or struct {
+	Left  Expr
+	Right Expr
+}
+
+func (e Or) Eval(todo clido.Todo, project clido.Project, now time.Time) bool {
+	return e.Left.Eval(todo, project, now) || e.Right.Eval(todo, project, now)
+}
+
+func (e Or) String() string {
+	return fmt.Sprintf("(%s OR %s)", e.Left, e.Right)
+}
+
+type Not struct {
+	Expr Expr
+}
+
+func (e Not) Eval(todo clido.Todo, project clido.Project, now time.Time) bool {
+	return !e.Expr.Eval(todo, project, now)
+}
+
+func (e Not) String() string {
+	return fmt.Sprintf("NOT %s", e.Expr)
+}
+
+// Saved is an expanded @name reference.
+type Saved struct {
+	Name string
+	Expr Expr
+}
+
+func (e Saved) Eval(todo clido.Todo, project clido.Project, now time.Time) bool {
+	return e.Expr.Eval(todo, project, now)
+}
+
+func (e Saved) String() string {
+	return e.Expr.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streed/cli-do-client/clido"
+)
+
+func TestEval(t *testing.T) {
+	var now = time.Date(2030, 1, 10, 18, 0, 0, 0, time.Local)
+	var date = func(d int) *time.Time {
+		var due = time.Date(2030, 1, d, 0, 0, 0, 0, time.UTC)
+		return &due
+	}
+
+	var release = clido.Todo{Ticket: 4, Subject: "Cut the Release", DueDate: date(12)}
+	var ops = clido.Project{Name: "Operations", Key: "OPS"}
+
+	var cases = []struct {
+		query string
+		todo  clido.Todo
+		want  bool
+	}{
+		{`due<7d AND NOT completed AND subject~"release"`, release, true},
+		{`due<2d`, release, false},
+		{`due<=2d`, release, true},
+		{`due=2030-01-12`, release, true},
+		{`due>today AND due<1w`, release, true},
+		{`due=none`, release, false},
+		{`due!=none`, release, true},
+		{`due<7d`, clido.Todo{}, false},
+		{`due=none`, clido.Todo{}, true},
+		{`completed`, clido.Todo{Completed: true}, true},
+		{`completed=false`, clido.Todo{Completed: true}, false},
+		{`past_due`, clido.Todo{DueDate: date(9)}, true},
+		{`ticket>=4 AND ticket<5`, release, true},
+		{`project=ops`, release, true},
+		{`project~oper AND project!=web`, release, true},
+		{`subject!~release OR ticket=4`, release, true},
+		{`NOT (ticket=4 OR ticket=5)`, release, false},
+		{`body~deploy or subject~'cut the'`, release, true},
+	}
+
+	for _, c := range cases {
+		expr, err := Parse(c.query, nil)
+
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+
+		if got := expr.Eval(c.todo, ops, now); got != c.want {
+			t.Errorf("%s (%s): got %t, want %t", c.query, expr, got, c.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var cases = map[string]string{
+		``:                      "empty query",
+		`owner=me`:              `unknown field "owner"`,
+		`subject<a`:             "subject does not support <",
+		`due<soon`:              "invalid value for due_date",
+		`ticket=four`:           "not a whole number",
+		`due<none`:              "none can only be compared",
+		`(completed`:            "expected )",
+		`completed AND`:         "unexpected end of query",
+		`subject~"open`:         "unterminated string",
+		`completed ticket=1`:    `unexpected "ticket"`,
+		`@missing`:              `no saved query named "missing"`,
+		`@loop`:                 `refers to itself`,
+		`completed AND @broken`: "in saved query @broken",
+	}
+
+	var saved = map[string]string{
+		"loop":   "completed OR @loop",
+		"broken": "due<",
+	}
+
+	for input, want := range cases {
+		_, err := Parse(input, saved)
+
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want an error containing %q", input, err, want)
+		}
+	}
+
+	_, err := Parse(`completed AND owner=me`, nil)
+
+	var syntaxError *SyntaxError
+
+	if !errors.As(err, &syntaxError) || syntaxError.Pos != 14 {
+		t.Fatalf("got %#v, want a syntax error at the field", err)
+	}
+}
+
+func TestSavedQueries(t *testing.T) {
+	var saved = map[string]string{
+		"open":           "NOT completed",
+		"mine-this-week": "@open AND due<7d",
+	}
+
+	expr, err := Parse("@mine-this-week AND project=ops", saved)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var now = time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+	var due = now.AddDate(0, 0, 3)
+
+	if !expr.Eval(clido.Todo{DueDate: &due}, clido.Project{Key: "OPS"}, now) {
+		t.Fatalf("expected %s to match", expr)
+	}
+
+	if expr.Eval(clido.Todo{DueDate: &due, Completed: true}, clido.Project{Key: "OPS"}, now) {
+		t.Fatalf("expected %s not to match a completed todo", expr)
+	}
+}